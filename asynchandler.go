@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncHandler is a slog.Handler that queues records and passes them to a base
+// handler on a background goroutine, so the caller does not wait for enrichment
+// and serialization. Create it with NewAsyncHandler and call Close on shutdown.
+type AsyncHandler struct {
+	base  slog.Handler
+	queue *asyncQueue
+}
+
+type asyncRecord struct {
+	ctx     context.Context
+	handler slog.Handler
+	record  slog.Record
+}
+
+// asyncQueue is shared by an AsyncHandler and the handlers derived from it.
+type asyncQueue struct {
+	records chan asyncRecord
+	done    chan struct{}
+	onDrop  func(int)
+	dropped atomic.Int64
+
+	// mu guards closed, so no record is sent once records is closed.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncHandler returns a handler that queues up to bufSize records for base,
+// such as the handler of a logger returned by NewLogger:
+//
+//	async := telemetry.NewAsyncHandler(logger.Handler(), 4096, nil)
+//	defer async.Close(ctx)
+//	slog.SetDefault(slog.New(async))
+//
+// When the queue is full, records are dropped rather than blocking the caller,
+// and onDrop, when not nil, is called with the number of records dropped so far.
+// Levels are still checked synchronously by base.Enabled.
+func NewAsyncHandler(base slog.Handler, bufSize int, onDrop func(int)) *AsyncHandler {
+	q := &asyncQueue{
+		records: make(chan asyncRecord, bufSize),
+		done:    make(chan struct{}),
+		onDrop:  onDrop,
+	}
+	go q.run()
+	return &AsyncHandler{base: base, queue: q}
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	for r := range q.records {
+		// Like slog.Logger, there is no caller to return the error to.
+		_ = r.handler.Handle(r.ctx, r.record)
+	}
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.base.Enabled(ctx, level)
+}
+
+// Handle queues a copy of record. The context is kept for its values, such as
+// the span context, and may be canceled by the time the record is handled.
+func (h *AsyncHandler) Handle(ctx context.Context, record slog.Record) error {
+	q := h.queue
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return errors.New("async log handler is closed")
+	}
+	select {
+	case q.records <- asyncRecord{ctx: context.WithoutCancel(ctx), handler: h.base, record: record.Clone()}:
+	default:
+		dropped := q.dropped.Add(1)
+		if q.onDrop != nil {
+			q.onDrop(int(dropped))
+		}
+	}
+	return nil
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{base: h.base.WithAttrs(attrs), queue: h.queue}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{base: h.base.WithGroup(name), queue: h.queue}
+}
+
+// Close stops accepting records and waits until the queued ones are handled, or
+// ctx is done. Records logged afterwards are rejected with an error.
+func (h *AsyncHandler) Close(ctx context.Context) error {
+	q := h.queue
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.records)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// gatedHandler blocks every record until the gate is closed.
+type gatedHandler struct {
+	slog.Handler
+	gate chan struct{}
+}
+
+func (h *gatedHandler) Handle(ctx context.Context, r slog.Record) error {
+	<-h.gate
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *gatedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &gatedHandler{Handler: h.Handler.WithAttrs(attrs), gate: h.gate}
+}
+
+func TestAsyncHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(LoggingConfig{Format: "json", Writer: &buf})
+	gate := make(chan struct{})
+	base := &gatedHandler{Handler: logger.Handler(), gate: gate}
+
+	var mu sync.Mutex
+	var drops []int
+	async := NewAsyncHandler(base, 2, func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		drops = append(drops, n)
+	})
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x02},
+	})
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), sc))
+	log := slog.New(async).With("component", "api")
+
+	// The first record is taken by the worker, which blocks on the gate, and
+	// the next two fill the queue.
+	log.InfoContext(ctx, "first")
+	require.Eventually(t, func() bool { return len(async.queue.records) == 0 }, time.Second, time.Millisecond)
+	log.InfoContext(ctx, "second")
+	log.InfoContext(ctx, "third")
+	log.InfoContext(ctx, "dropped")
+	log.InfoContext(ctx, "dropped again")
+	log.DebugContext(ctx, "below the level is not queued")
+	cancel()
+
+	close(gate)
+	require.NoError(t, async.Close(context.Background()))
+	require.Error(t, async.Handle(context.Background(), slog.Record{}))
+
+	require.Equal(t, []int{1, 2}, drops)
+	var messages []string
+	for _, entry := range logEntries(t, &buf) {
+		messages = append(messages, entry["message"].(string))
+		require.Equal(t, "api", entry["component"])
+		require.Equal(t, sc.TraceID().String(), entry["logging.googleapis.com/trace"], "enriched from the queued context")
+	}
+	require.Equal(t, []string{"first", "second", "third"}, messages)
+}
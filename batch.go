@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// batchConfig holds the settings of the batch span processor created by
+// InitTracer.
+type batchConfig struct {
+	maxQueueSize       int
+	maxExportBatchSize int
+	scheduleDelay      time.Duration
+	exportTimeout      time.Duration
+}
+
+// batchConfigFromEnv reads the standard OTEL_BSP_MAX_QUEUE_SIZE,
+// OTEL_BSP_MAX_EXPORT_BATCH_SIZE, OTEL_BSP_SCHEDULE_DELAY and
+// OTEL_BSP_EXPORT_TIMEOUT variables, the last two in milliseconds. Unset or
+// invalid values keep the SDK defaults. The batch size is capped at the queue
+// size, since a batch is taken from the queue.
+func batchConfigFromEnv() batchConfig {
+	cfg := batchConfig{
+		maxQueueSize:       positiveIntFromEnv("OTEL_BSP_MAX_QUEUE_SIZE", sdktrace.DefaultMaxQueueSize),
+		maxExportBatchSize: positiveIntFromEnv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", sdktrace.DefaultMaxExportBatchSize),
+		scheduleDelay:      time.Duration(positiveIntFromEnv("OTEL_BSP_SCHEDULE_DELAY", sdktrace.DefaultScheduleDelay)) * time.Millisecond,
+		exportTimeout:      time.Duration(positiveIntFromEnv("OTEL_BSP_EXPORT_TIMEOUT", sdktrace.DefaultExportTimeout)) * time.Millisecond,
+	}
+	cfg.maxExportBatchSize = min(cfg.maxExportBatchSize, cfg.maxQueueSize)
+	return cfg
+}
+
+func (c batchConfig) options() []sdktrace.BatchSpanProcessorOption {
+	return []sdktrace.BatchSpanProcessorOption{
+		sdktrace.WithMaxQueueSize(c.maxQueueSize),
+		sdktrace.WithMaxExportBatchSize(c.maxExportBatchSize),
+		sdktrace.WithBatchTimeout(c.scheduleDelay),
+		sdktrace.WithExportTimeout(c.exportTimeout),
+	}
+}
+
+// log records the effective configuration, so overrides can be checked at startup.
+func (c batchConfig) log(ctx context.Context) {
+	slog.InfoContext(ctx, "batch span processor configured",
+		"max_queue_size", c.maxQueueSize,
+		"max_export_batch_size", c.maxExportBatchSize,
+		"schedule_delay_ms", c.scheduleDelay.Milliseconds(),
+		"export_timeout_ms", c.exportTimeout.Milliseconds(),
+	)
+}
+
+// positiveIntFromEnv parses the positive integer in the variable key, returning
+// def when it is unset or invalid.
+func positiveIntFromEnv(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		slog.Warn("invalid "+key+", using the default", "value", value, "default", def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestBatchConfigFromEnv(t *testing.T) {
+	defaults := batchConfig{
+		maxQueueSize:       sdktrace.DefaultMaxQueueSize,
+		maxExportBatchSize: sdktrace.DefaultMaxExportBatchSize,
+		scheduleDelay:      sdktrace.DefaultScheduleDelay * time.Millisecond,
+		exportTimeout:      sdktrace.DefaultExportTimeout * time.Millisecond,
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want batchConfig
+	}{
+		{name: "defaults", want: defaults},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"OTEL_BSP_MAX_QUEUE_SIZE":        "8192",
+				"OTEL_BSP_MAX_EXPORT_BATCH_SIZE": "1024",
+				"OTEL_BSP_SCHEDULE_DELAY":        "250",
+				"OTEL_BSP_EXPORT_TIMEOUT":        "10000",
+			},
+			want: batchConfig{
+				maxQueueSize:       8192,
+				maxExportBatchSize: 1024,
+				scheduleDelay:      250 * time.Millisecond,
+				exportTimeout:      10 * time.Second,
+			},
+		},
+		{
+			name: "invalid values keep the defaults",
+			env: map[string]string{
+				"OTEL_BSP_MAX_QUEUE_SIZE": "lots",
+				"OTEL_BSP_SCHEDULE_DELAY": "-1",
+			},
+			want: defaults,
+		},
+		{
+			name: "batch size capped at queue size",
+			env:  map[string]string{"OTEL_BSP_MAX_QUEUE_SIZE": "100"},
+			want: batchConfig{
+				maxQueueSize:       100,
+				maxExportBatchSize: 100,
+				scheduleDelay:      defaults.scheduleDelay,
+				exportTimeout:      defaults.exportTimeout,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			require.Equal(t, tt.want, batchConfigFromEnv())
+		})
+	}
+}
+
+func TestInitTracerLogsBatchConfig(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+	t.Setenv("OTEL_BSP_MAX_QUEUE_SIZE", "4096")
+	initTestTracer(t)
+
+	var found bool
+	for _, entry := range logEntries(t, &buf) {
+		if entry["message"] == "batch span processor configured" {
+			found = true
+			require.EqualValues(t, 4096, entry["max_queue_size"])
+			require.EqualValues(t, sdktrace.DefaultMaxExportBatchSize, entry["max_export_batch_size"])
+		}
+	}
+	require.True(t, found)
+}
@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OverflowValue replaces every attribute value of a measurement recorded past
+// the cardinality limit of a metric, so the excess is counted in a single
+// series instead of creating new ones.
+const OverflowValue = "__overflow__"
+
+// cardinalityLimiter bounds the number of attribute sets recorded for a metric.
+// The SDK's own limit applies to every instrument of a MeterProvider and marks
+// the excess with an otel.metric.overflow attribute, which dashboards grouping
+// by route do not pick up.
+type cardinalityLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	seen map[attribute.Distinct]struct{}
+}
+
+// newCardinalityLimiter returns a limiter that lets limit distinct attribute
+// sets through. A limit of zero or less disables it.
+func newCardinalityLimiter(limit int) *cardinalityLimiter {
+	return &cardinalityLimiter{
+		limit: limit,
+		seen:  make(map[attribute.Distinct]struct{}),
+	}
+}
+
+// attributes returns attrs, or attrs with each value replaced by OverflowValue
+// once limit other sets have been recorded.
+func (l *cardinalityLimiter) attributes(attrs ...attribute.KeyValue) attribute.Set {
+	set := attribute.NewSet(attrs...)
+	if l == nil || l.limit <= 0 {
+		return set
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[set.Equivalent()]; ok {
+		return set
+	}
+	if len(l.seen) < l.limit {
+		l.seen[set.Equivalent()] = struct{}{}
+		return set
+	}
+
+	overflow := make([]attribute.KeyValue, 0, set.Len())
+	for iter := set.Iter(); iter.Next(); {
+		overflow = append(overflow, iter.Attribute().Key.String(OverflowValue))
+	}
+	return attribute.NewSet(overflow...)
+}
@@ -0,0 +1,164 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultChromeTraceFile is written by the chrometrace exporter when
+// TELEMETRY_CHROMETRACE_FILE is unset.
+const defaultChromeTraceFile = "trace.json"
+
+// NewChromeTraceExporter returns an exporter that writes spans to w in the Chrome
+// trace event format, which chrome://tracing and Perfetto can load for local
+// profiling. Each span is a begin ("B") and end ("E") event pair. The viewers
+// nest the pairs of one thread, so the spans of a trace share a thread unless
+// they overlap without one containing the other, as concurrent siblings do; such
+// a span is placed on another thread of the trace. Events are written as they are
+// exported, so a ForceFlush of the TracerProvider puts the pending spans in w.
+// The JSON array is closed on Shutdown, and w is closed afterwards if it is an
+// io.Closer; the viewers also load a file whose array was never closed.
+func NewChromeTraceExporter(w io.Writer) sdktrace.SpanExporter {
+	return &chromeTraceExporter{w: w, lanes: make(map[trace.TraceID][]*chromeTraceLane)}
+}
+
+// chromeTraceEvent is one begin ("B") or end ("E") event of the trace event format.
+// Timestamps are in microseconds.
+type chromeTraceEvent struct {
+	Name      string         `json:"name"`
+	Cat       string         `json:"cat"`
+	Phase     string         `json:"ph"`
+	Timestamp float64        `json:"ts"`
+	PID       int            `json:"pid"`
+	TID       int            `json:"tid"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+// chromeTraceLane is one thread of a trace and the spans already placed on it.
+type chromeTraceLane struct {
+	tid   int
+	spans []chromeTraceInterval
+}
+
+type chromeTraceInterval struct {
+	start, end time.Time
+}
+
+// fits reports whether span nests with every span of the lane: each pair is
+// either disjoint or one contains the other.
+func (l *chromeTraceLane) fits(span chromeTraceInterval) bool {
+	for _, other := range l.spans {
+		disjoint := !span.end.After(other.start) || !span.start.Before(other.end)
+		contains := !span.start.After(other.start) && !span.end.Before(other.end)
+		within := !other.start.After(span.start) && !other.end.Before(span.end)
+		if !disjoint && !contains && !within {
+			return false
+		}
+	}
+	return true
+}
+
+type chromeTraceExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// lanes holds the threads of each trace, which are kept for the lifetime of
+	// the exporter.
+	lanes   map[trace.TraceID][]*chromeTraceLane
+	threads int
+	started bool
+	stopped bool
+}
+
+// tid places span on the first thread of its trace where it nests, or a new one.
+func (e *chromeTraceExporter) tid(traceID trace.TraceID, span chromeTraceInterval) int {
+	lanes := e.lanes[traceID]
+	for _, lane := range lanes {
+		if lane.fits(span) {
+			lane.spans = append(lane.spans, span)
+			return lane.tid
+		}
+	}
+	e.threads++
+	e.lanes[traceID] = append(lanes, &chromeTraceLane{tid: e.threads, spans: []chromeTraceInterval{span}})
+	return e.threads
+}
+
+func (e *chromeTraceExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped || len(spans) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, s := range spans {
+		tid := e.tid(s.SpanContext().TraceID(), chromeTraceInterval{start: s.StartTime(), end: s.EndTime()})
+		args := make(map[string]any, len(s.Attributes()))
+		for _, attr := range s.Attributes() {
+			args[string(attr.Key)] = attr.Value.AsInterface()
+		}
+		cat := strings.ToLower(s.SpanKind().String())
+		for _, event := range []chromeTraceEvent{
+			{Name: s.Name(), Cat: cat, Phase: "B", Timestamp: float64(s.StartTime().UnixNano()) / 1e3, PID: 1, TID: tid, Args: args},
+			{Name: s.Name(), Cat: cat, Phase: "E", Timestamp: float64(s.EndTime().UnixNano()) / 1e3, PID: 1, TID: tid},
+		} {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if e.started || buf.Len() > 0 {
+				buf.WriteString(",\n")
+			} else {
+				buf.WriteString("[\n")
+			}
+			buf.Write(data)
+		}
+	}
+	if _, err := e.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	e.started = true
+	return nil
+}
+
+func (e *chromeTraceExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return nil
+	}
+	e.stopped = true
+
+	end := "\n]\n"
+	if !e.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	if c, ok := e.w.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// createChromeTraceExporter writes to TELEMETRY_CHROMETRACE_FILE, or trace.json.
+func createChromeTraceExporter() (sdktrace.SpanExporter, error) {
+	path := strings.TrimSpace(os.Getenv("TELEMETRY_CHROMETRACE_FILE"))
+	if path == "" {
+		path = defaultChromeTraceFile
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewChromeTraceExporter(f), nil
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestChromeTraceExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	t.Setenv("TELEMETRY_CHROMETRACE_FILE", path)
+	exporter, err := createTraceExporter(context.Background(), ExporterChromeTrace)
+	require.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	tracer := tp.Tracer("test")
+	start := time.Unix(100, 0)
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.WithTimestamp(start))
+	_, first := tracer.Start(ctx, "first", trace.WithTimestamp(start.Add(time.Millisecond)),
+		trace.WithAttributes(attribute.String("key", "value")))
+	_, second := tracer.Start(ctx, "second", trace.WithTimestamp(start.Add(1500*time.Microsecond)))
+	first.End(trace.WithTimestamp(start.Add(2 * time.Millisecond)))
+	second.End(trace.WithTimestamp(start.Add(2500 * time.Microsecond)))
+
+	type event struct {
+		name, ph string
+		ts       float64
+		tid      int
+	}
+	read := func(closing string) []event {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var events []chromeTraceEvent
+		require.NoError(t, json.Unmarshal(append(data, closing...), &events))
+		var got []event
+		for _, ev := range events {
+			got = append(got, event{ev.Name, ev.Phase, ev.Timestamp, ev.TID})
+		}
+		require.Equal(t, "value", events[0].Args["key"])
+		return got
+	}
+
+	// The viewers load a file whose array is not closed yet. The overlapping
+	// siblings are placed on different threads so each thread nests.
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	siblings := []event{
+		{"first", "B", 100_001_000, 1},
+		{"first", "E", 100_002_000, 1},
+		{"second", "B", 100_001_500, 2},
+		{"second", "E", 100_002_500, 2},
+	}
+	require.Equal(t, siblings, read("]"))
+
+	parent.End(trace.WithTimestamp(start.Add(3 * time.Millisecond)))
+	require.NoError(t, tp.Shutdown(context.Background()))
+	require.Equal(t, append(siblings,
+		event{"parent", "B", 100_000_000, 1},
+		event{"parent", "E", 100_003_000, 1},
+	), read(""))
+}
@@ -0,0 +1,16 @@
+package telemetry
+
+import "time"
+
+// clock tells the time to the processors that measure durations, so tests can
+// drive them deterministically.
+type clock interface {
+	Now() time.Time
+}
+
+// wallClock is the default clock, backed by time.Now.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
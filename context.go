@@ -0,0 +1,174 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// contextKey is the type of all context keys defined by this package. Being
+// unexported, it cannot collide with keys defined by other packages.
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	sampleRateKey
+	transactionIDKey
+	logLevelKey
+	suppressSpansKey
+)
+
+// ContextWithLogger returns a copy of ctx that carries logger.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// LoggerFromContext returns the logger stored by ContextWithLogger, or the
+// default logger if ctx does not carry one.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// contextWithSampleRate returns a copy of ctx that overrides the sampling ratio
+// applied by filterSampler to spans started from it.
+func contextWithSampleRate(ctx context.Context, rate float64) context.Context {
+	return context.WithValue(ctx, sampleRateKey, rate)
+}
+
+func sampleRateFromContext(ctx context.Context) (float64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	rate, ok := ctx.Value(sampleRateKey).(float64)
+	return rate, ok
+}
+
+// WithLogLevel returns a copy of ctx under which the minimum level of the logger
+// set up by SetupLogging is level instead of the configured one, to get debug logs
+// from one code path, or silence a noisy one. It only applies to logs written with
+// ctx, such as slog.DebugContext(ctx, ...). Handlers added with WithHandlers keep
+// their own level.
+func WithLogLevel(ctx context.Context, level slog.Level) context.Context {
+	return context.WithValue(ctx, logLevelKey, level)
+}
+
+func logLevelFromContext(ctx context.Context) (slog.Level, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok := ctx.Value(logLevelKey).(slog.Level)
+	return level, ok
+}
+
+// SuppressSpans returns a copy of ctx under which Tracer.Span, the span helpers
+// of this package, such as SpanWithTimeout and RetrySpan, and its gRPC
+// interceptors start no span, to keep a noisy subtree of a heavy operation out of
+// the trace. They return a noop span carrying the span context of ctx instead, so
+// logs and outgoing requests still join the enclosing trace. Spans started directly through an OpenTelemetry
+// tracer, such as those of otelhttp, are not suppressed.
+func SuppressSpans(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressSpansKey, true)
+}
+
+// suppressedTracer starts the spans of a context passed to SuppressSpans. A noop
+// tracer returns a span with the span context of the parent.
+var suppressedTracer = noop.NewTracerProvider().Tracer("")
+
+// tracerFor returns tracer, or suppressedTracer when ctx suppresses spans.
+func tracerFor(ctx context.Context, tracer trace.Tracer) trace.Tracer {
+	if suppressed, _ := ctx.Value(suppressSpansKey).(bool); suppressed {
+		return suppressedTracer
+	}
+	return tracer
+}
+
+// TransactionIDKey is the span and log attribute carrying the ID set by
+// ContextWithTransactionID.
+const TransactionIDKey = attribute.Key("transaction.id")
+
+// ContextWithTransactionID returns a copy of ctx that carries the ID of a business
+// transaction, such as a multi-step saga spanning several traces. Spans started by
+// the provider installed by InitTracer, and logs written through SetupLogging, carry
+// it as TransactionIDKey.
+func ContextWithTransactionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, transactionIDKey, id)
+}
+
+// TransactionIDFromContext returns the ID set by ContextWithTransactionID.
+func TransactionIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(transactionIDKey).(string)
+	return id, ok && id != ""
+}
+
+// SetBaggage returns a copy of ctx whose baggage has key set to value, replacing
+// any previous value. The propagator installed by InitTracer sends baggage to
+// downstream services, which read it with GetBaggage, so it suits values such as
+// a tenant ID. An empty key, or baggage over the W3C size limits, leaves ctx
+// unchanged and logs a warning.
+func SetBaggage(ctx context.Context, key, value string) context.Context {
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		slog.WarnContext(ctx, "ignoring invalid baggage member", "key", key, "error", err)
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		slog.WarnContext(ctx, "ignoring baggage member", "key", key, "error", err)
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// GetBaggage returns the baggage value of key in ctx, or "" when it is absent.
+func GetBaggage(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// serializedContextVersion prefixes the strings written by SerializeContext so
+// the format can change without breaking values already stored.
+const serializedContextVersion = "1"
+
+// SerializeContext returns the trace context of ctx as a string, for example to
+// persist it with a queued job. The result is empty when ctx carries no valid
+// span context. Use DeserializeContext to restore it.
+func SerializeContext(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	traceparent := carrier.Get("traceparent")
+	if traceparent == "" {
+		return ""
+	}
+	// The traceparent never contains a separator, so the tracestate may.
+	return serializedContextVersion + ";" + traceparent + ";" + carrier.Get("tracestate")
+}
+
+// DeserializeContext returns a copy of ctx carrying the remote span context
+// stored by SerializeContext, so spans started from it join the original trace.
+// Empty, malformed or unknown-version values leave ctx unchanged.
+func DeserializeContext(ctx context.Context, s string) context.Context {
+	if s == "" {
+		return ctx
+	}
+	parts := strings.SplitN(s, ";", 3)
+	if len(parts) != 3 || parts[0] != serializedContextVersion {
+		slog.DebugContext(ctx, "ignoring unsupported serialized trace context", "value", s)
+		return ctx
+	}
+	carrier := propagation.MapCarrier{"traceparent": parts[1]}
+	if parts[2] != "" {
+		carrier["tracestate"] = parts[2]
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
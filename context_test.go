@@ -0,0 +1,144 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	t.Run("no logger returns default", func(t *testing.T) {
+		require.Same(t, slog.Default(), LoggerFromContext(context.Background()))
+	})
+
+	t.Run("user string key does not collide", func(t *testing.T) {
+		userLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		ctx := context.WithValue(context.Background(), "logger", userLogger) //nolint:staticcheck // testing collisions
+		require.Same(t, slog.Default(), LoggerFromContext(ctx))
+
+		logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+		ctx = ContextWithLogger(ctx, logger)
+		ctx = context.WithValue(ctx, "logger", userLogger) //nolint:staticcheck // testing collisions
+		require.Same(t, logger, LoggerFromContext(ctx))
+		require.Same(t, userLogger, ctx.Value("logger"))
+	})
+}
+
+func TestSerializeContext(t *testing.T) {
+	state, err := trace.ParseTraceState("vendor=value,other=a;b")
+	require.NoError(t, err)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	serialized := SerializeContext(ctx)
+	require.True(t, strings.HasPrefix(serialized, "1;"))
+
+	restored := trace.SpanContextFromContext(DeserializeContext(context.Background(), serialized))
+	require.True(t, restored.IsRemote())
+	require.Equal(t, sc.TraceID(), restored.TraceID())
+	require.Equal(t, sc.SpanID(), restored.SpanID())
+	require.True(t, restored.IsSampled())
+	require.Equal(t, state.String(), restored.TraceState().String())
+
+	t.Run("no span context", func(t *testing.T) {
+		require.Empty(t, SerializeContext(context.Background()))
+	})
+
+	t.Run("unsupported values are ignored", func(t *testing.T) {
+		for _, value := range []string{"", "2;" + serialized[2:], "garbage"} {
+			ctx := DeserializeContext(context.Background(), value)
+			require.False(t, trace.SpanContextFromContext(ctx).IsValid(), value)
+		}
+	})
+}
+
+func TestTransactionID(t *testing.T) {
+	recorder := setTestTracerProvider(t, sdktrace.WithSpanProcessor(transactionIDProcessor{}))
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	ctx := ContextWithTransactionID(context.Background(), "saga-42")
+	for _, name := range []string{"reserve", "charge"} {
+		// Each step is a separate trace that shares the transaction
+		spanCtx, span := otel.Tracer("test").Start(ctx, name)
+		slog.InfoContext(spanCtx, name)
+		span.End()
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.NotEqual(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	for _, span := range spans {
+		require.Contains(t, span.Attributes(), TransactionIDKey.String("saga-42"))
+	}
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		require.Equal(t, "saga-42", entry[string(TransactionIDKey)])
+	}
+
+	_, ok := TransactionIDFromContext(context.Background())
+	require.False(t, ok)
+}
+
+func TestBaggage(t *testing.T) {
+	ctx := SetBaggage(context.Background(), "tenant.id", "acme corp")
+	ctx = SetBaggage(ctx, "tenant.id", "globex")
+	ctx = SetBaggage(ctx, "region", "eu")
+	require.Equal(t, "globex", GetBaggage(ctx, "tenant.id"))
+	require.Equal(t, "eu", GetBaggage(ctx, "region"))
+	require.Empty(t, GetBaggage(ctx, "missing"))
+	require.Empty(t, GetBaggage(context.Background(), "tenant.id"))
+
+	invalid := SetBaggage(ctx, "", "value")
+	require.Equal(t, ctx, invalid, "an empty key leaves the context unchanged")
+
+	// Values survive propagation to another service
+	carrier := propagation.MapCarrier{}
+	propagation.Baggage{}.Inject(SetBaggage(ctx, "tenant.id", "acme corp"), carrier)
+	remote := propagation.Baggage{}.Extract(context.Background(), carrier)
+	require.Equal(t, "acme corp", GetBaggage(remote, "tenant.id"))
+}
+
+func TestSuppressSpans(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	tracer := NewTracer("test")
+
+	ctx, parent := tracer.Span(context.Background())
+	suppressed := SuppressSpans(ctx)
+
+	childCtx, child := tracer.Span(suppressed)
+	require.False(t, child.IsRecording())
+	require.Equal(t, parent.SpanContext(), child.SpanContext(), "the trace context still propagates")
+	_, retry := RetrySpan(childCtx, "retry", 1, trace.SpanContext{})
+	_, timeout, cancel := SpanWithTimeout(childCtx, "timeout", time.Minute)
+	retry.End()
+	timeout.End()
+	cancel()
+	child.End()
+
+	_, sibling := tracer.Span(ctx)
+	sibling.End()
+	parent.End()
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	require.Equal(t, sibling.SpanContext(), ended[0].SpanContext())
+	require.Equal(t, parent.SpanContext(), ended[1].SpanContext())
+}
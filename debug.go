@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// debugFlushTimeout bounds a flush triggered through DebugHandler.
+const debugFlushTimeout = 10 * time.Second
+
+// Pipeline statuses reported by the health endpoint of DebugHandler.
+const (
+	pipelineOK             = "ok"
+	pipelineNotInitialized = "not initialized"
+)
+
+// configEnvPrefixes select the environment variables reported by the config
+// endpoint of DebugHandler.
+var configEnvPrefixes = []string{"OTEL_", "TELEMETRY_"}
+
+// secretEnvMarkers mark variables whose value is redacted by the config endpoint,
+// such as OTEL_EXPORTER_OTLP_HEADERS, which usually holds an API key.
+var secretEnvMarkers = []string{"HEADERS", "KEY", "TOKEN", "SECRET", "PASSWORD"}
+
+// DebugHandler returns a handler serving the state of the telemetry pipelines
+// for a single ops endpoint:
+//
+//   - GET config: the version and the OTEL_* and TELEMETRY_* environment
+//     variables, with secrets such as OTLP headers redacted.
+//   - GET health: whether tracing and metrics are initialized, with 503 Service
+//     Unavailable when one is not.
+//   - GET and PUT loglevel: the level of the logger set up by SetupLogging, such
+//     as {"level":"DEBUG"}. PUT changes it until the process restarts.
+//   - POST flush: exports pending spans and metrics now.
+//
+// Responses are JSON. The handler expects the paths above at its root; mount it
+// with http.StripPrefix, for example under "/debug/telemetry/". It exposes
+// configuration, so it should only be reachable by operators.
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /config", serveDebugConfig)
+	mux.HandleFunc("GET /health", serveDebugHealth)
+	mux.HandleFunc("GET /loglevel", serveDebugLogLevel)
+	mux.HandleFunc("PUT /loglevel", setDebugLogLevel)
+	mux.HandleFunc("POST /flush", serveDebugFlush)
+	return mux
+}
+
+func serveDebugConfig(w http.ResponseWriter, r *http.Request) {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !slices.ContainsFunc(configEnvPrefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			continue
+		}
+		if slices.ContainsFunc(secretEnvMarkers, func(marker string) bool { return strings.Contains(key, marker) }) {
+			value = redactedValue
+		}
+		env[key] = value
+	}
+	writeDebugJSON(w, http.StatusOK, map[string]any{
+		"version": Version,
+		"commit":  Commit,
+		"env":     env,
+	})
+}
+
+func serveDebugHealth(w http.ResponseWriter, r *http.Request) {
+	health := map[string]string{
+		"tracing": pipelineNotInitialized,
+		"metrics": pipelineNotInitialized,
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		health["tracing"] = pipelineOK
+	}
+	if _, ok := otel.GetMeterProvider().(*sdkmetric.MeterProvider); ok {
+		health["metrics"] = pipelineOK
+	}
+
+	status := http.StatusOK
+	for _, state := range health {
+		if state != pipelineOK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeDebugJSON(w, status, health)
+}
+
+// debugLogLevel is the body of the loglevel endpoint.
+type debugLogLevel struct {
+	Level string `json:"level"`
+}
+
+func serveDebugLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeDebugJSON(w, http.StatusOK, debugLogLevel{Level: defaultLogLevel.Level().String()})
+}
+
+func setDebugLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body debugLogLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+		writeDebugJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body: " + err.Error()})
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+		writeDebugJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if previous := defaultLogLevel.Level(); previous != level {
+		defaultLogLevel.Set(level)
+		slog.InfoContext(r.Context(), "log level changed", "from", previous.String(), "to", level.String())
+	}
+	serveDebugLogLevel(w, r)
+}
+
+func serveDebugFlush(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), debugFlushTimeout)
+	defer cancel()
+
+	var errs []error
+	if tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		errs = append(errs, tp.ForceFlush(ctx))
+	}
+	if mp, ok := otel.GetMeterProvider().(*sdkmetric.MeterProvider); ok {
+		errs = append(errs, mp.ForceFlush(ctx))
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeDebugJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, map[string]string{"status": "flushed"})
+}
+
+func writeDebugJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write debug response", "error", err)
+	}
+}
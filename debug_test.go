@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func serveDebug(t *testing.T, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	handler := http.StripPrefix("/debug/telemetry", DebugHandler())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, "/debug/telemetry"+path, strings.NewReader(body)))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	return rec.Code, got
+}
+
+func TestDebugHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+	t.Setenv("OTEL_SERVICE_NAME", "checkout")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret")
+
+	t.Run("config", func(t *testing.T) {
+		code, got := serveDebug(t, http.MethodGet, "/config", "")
+		require.Equal(t, http.StatusOK, code)
+		env := got["env"].(map[string]any)
+		require.Equal(t, "checkout", env["OTEL_SERVICE_NAME"])
+		require.Equal(t, redactedValue, env["OTEL_EXPORTER_OTLP_HEADERS"])
+	})
+
+	t.Run("health", func(t *testing.T) {
+		prev := otel.GetMeterProvider()
+		t.Cleanup(func() { otel.SetMeterProvider(prev) })
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+		code, got := serveDebug(t, http.MethodGet, "/health", "")
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, map[string]any{"tracing": pipelineNotInitialized, "metrics": pipelineOK}, got)
+
+		setTestTracerProvider(t)
+		code, got = serveDebug(t, http.MethodGet, "/health", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]any{"tracing": pipelineOK, "metrics": pipelineOK}, got)
+	})
+
+	t.Run("log level", func(t *testing.T) {
+		code, got := serveDebug(t, http.MethodGet, "/loglevel", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "INFO", got["level"])
+		require.False(t, slog.Default().Enabled(t.Context(), slog.LevelDebug))
+
+		code, got = serveDebug(t, http.MethodPut, "/loglevel", `{"level":"debug"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "DEBUG", got["level"])
+		require.True(t, slog.Default().Enabled(t.Context(), slog.LevelDebug))
+
+		code, got = serveDebug(t, http.MethodPut, "/loglevel", `{"level":"loud"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, got["error"], "loud")
+		require.True(t, slog.Default().Enabled(t.Context(), slog.LevelDebug))
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		recorder := setTestTracerProvider(t)
+		_, span := otel.Tracer("test").Start(t.Context(), "pending")
+		span.End()
+
+		code, got := serveDebug(t, http.MethodPost, "/flush", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "flushed", got["status"])
+		require.Len(t, recorder.Ended(), 1)
+	})
+}
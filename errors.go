@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedError carries the span context in which an error occurred.
+type tracedError struct {
+	err error
+	sc  trace.SpanContext
+}
+
+func (e *tracedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tracedError) Unwrap() error {
+	return e.err
+}
+
+// WrapError attaches the span context of ctx to err, so the error can be logged
+// with its original trace after it has been returned up many layers. It returns
+// err unchanged when it is nil, when ctx carries no valid span context, or when
+// err already carries one, which keeps the span closest to the failure.
+func WrapError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return err
+	}
+	if _, ok := SpanContextFromError(err); ok {
+		return err
+	}
+	return &tracedError{err: err, sc: sc}
+}
+
+// SpanContextFromError returns the span context attached by WrapError anywhere
+// in the chain of err.
+func SpanContextFromError(err error) (trace.SpanContext, bool) {
+	var traced *tracedError
+	if errors.As(err, &traced) {
+		return traced.sc, true
+	}
+	return trace.SpanContext{}, false
+}
+
+// LogError logs err at error level with the logger from ctx (see LoggerFromContext).
+// When ctx has no span but err was wrapped by WrapError, the record carries the
+// trace and span IDs of the error instead.
+func LogError(ctx context.Context, err error, msg string, args ...any) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if sc, ok := SpanContextFromError(err); ok {
+			ctx = trace.ContextWithSpanContext(ctx, sc)
+		}
+	}
+	LoggerFromContext(ctx).ErrorContext(ctx, msg, append(args, "error", err)...)
+}
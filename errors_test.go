@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWrapError(t *testing.T) {
+	setTestTracerProvider(t)
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	base := errors.New("connection refused")
+	ctx, span := otel.Tracer("test").Start(context.Background(), "query")
+	err := WrapError(ctx, base)
+	span.End()
+
+	require.ErrorIs(t, err, base)
+	require.Equal(t, "connection refused", err.Error())
+	// Wrapping again keeps the original span
+	_, other := otel.Tracer("test").Start(context.Background(), "handler")
+	require.Same(t, err, WrapError(trace.ContextWithSpan(context.Background(), other), err))
+	other.End()
+
+	LogError(context.Background(), err, "request failed", "attempt", 2)
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	require.Equal(t, span.SpanContext().TraceID().String(), entries[0]["logging.googleapis.com/trace"])
+	require.Equal(t, span.SpanContext().SpanID().String(), entries[0]["logging.googleapis.com/spanId"])
+	require.Equal(t, "connection refused", entries[0]["error"])
+	require.EqualValues(t, 2, entries[0]["attempt"])
+
+	require.Same(t, base, WrapError(context.Background(), base), "no span to attach")
+	require.NoError(t, WrapError(ctx, nil))
+}
@@ -0,0 +1,478 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// exporterNameFromEnv returns the exporter selected by the signal-specific variable,
+// such as OTEL_TRACES_EXPORTER, falling back to the generic OTEL_EXPORTER.
+// An empty result selects the default exporter.
+func exporterNameFromEnv(signalKey string) string {
+	for _, key := range []string{signalKey, "OTEL_EXPORTER"} {
+		if name := strings.ToLower(strings.TrimSpace(os.Getenv(key))); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// ExporterType names a span exporter, as accepted by WithExporter and the
+// OTEL_TRACES_EXPORTER variable.
+type ExporterType string
+
+const (
+	// ExporterGCP exports to Google Cloud Trace. It is the default.
+	ExporterGCP ExporterType = "gcp"
+	// ExporterOTLP exports over OTLP, configured by OTEL_EXPORTER_OTLP_* variables.
+	// OTEL_EXPORTER_OTLP_PROTOCOL, or OTEL_EXPORTER_OTLP_TRACES_PROTOCOL, selects
+	// the transport: http/protobuf by default, or grpc.
+	ExporterOTLP ExporterType = "otlp"
+	// ExporterConsole writes spans as JSON to stdout, which is convenient in tests.
+	// See createConsoleExporter for the output format.
+	ExporterConsole ExporterType = "console"
+	// ExporterChromeTrace writes spans in the Chrome trace event format to the file
+	// named by TELEMETRY_CHROMETRACE_FILE (trace.json by default) as they are
+	// exported, and completes the file on shutdown.
+	// See NewChromeTraceExporter.
+	ExporterChromeTrace ExporterType = "chrometrace"
+	// ExporterNone discards every span.
+	ExporterNone ExporterType = "none"
+)
+
+// gcpFallbackExporterEnv names the exporter used instead of the google exporter
+// when no Google Cloud credentials are found, for example "console" on a laptop.
+// It accepts a list like OTEL_TRACES_EXPORTER; gcp is ignored in it.
+const gcpFallbackExporterEnv = "TELEMETRY_GCP_FALLBACK_EXPORTER"
+
+// createTraceExporter creates the span exporter of the given type. An empty type
+// selects the exporter named by OTEL_TRACES_EXPORTER, or OTEL_EXPORTER when unset,
+// and the google exporter by default. A comma-separated list, such as "gcp,otlp",
+// creates every listed exporter and sends each span to all of them.
+func createTraceExporter(ctx context.Context, exporterType ExporterType) (sdktrace.SpanExporter, error) {
+	if exporterType == "" {
+		exporterType = ExporterType(exporterNameFromEnv("OTEL_TRACES_EXPORTER"))
+	}
+	if strings.Contains(string(exporterType), ",") {
+		return createMultiExporter(ctx, strings.Split(string(exporterType), ","))
+	}
+	switch exporterType {
+	case "", ExporterGCP:
+		return createGCPExporter(ctx)
+	case ExporterOTLP:
+		return createOTLPExporter(ctx)
+	case ExporterConsole:
+		return createConsoleExporter()
+	case ExporterChromeTrace:
+		return createChromeTraceExporter()
+	case ExporterNone:
+		return noopExporter{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter %q", exporterType)
+	}
+}
+
+// createMultiExporter creates an exporter for each type and combines them. If one
+// fails, those already created are shut down.
+func createMultiExporter(ctx context.Context, types []string) (sdktrace.SpanExporter, error) {
+	var exporters multiExporter
+	for _, name := range types {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		exporter, err := createTraceExporter(ctx, ExporterType(name))
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("%s: %w", name, err), exporters.Shutdown(ctx))
+		}
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		return nil, fmt.Errorf("no traces exporter in %q", strings.Join(types, ","))
+	}
+	return exporters, nil
+}
+
+// multiExporter sends spans to several exporters, such as the old and new backend
+// during a migration. A failing exporter does not prevent the others from
+// receiving the spans.
+type multiExporter []sdktrace.SpanExporter
+
+func (m multiExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	var errs []error
+	for _, exporter := range m {
+		errs = append(errs, exporter.ExportSpans(ctx, spans))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exporter := range m {
+		errs = append(errs, exporter.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// createMetricExporter creates the metric exporter selected by OTEL_METRICS_EXPORTER,
+// or OTEL_EXPORTER when unset. The google exporter is used by default, and "none"
+// returns a nil exporter so metrics are recorded but never exported.
+func createMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	switch name := exporterNameFromEnv("OTEL_METRICS_EXPORTER"); name {
+	case "", "gcp":
+		return mexporter.New()
+	case "otlp":
+		var opts []otlpmetrichttp.Option
+		if endpoint := otlpEndpointFromEnv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", otlpMetricsPath); endpoint != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(endpoint))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	case "console":
+		return stdoutmetric.New()
+	case "none":
+		return nil, nil
+	case "prometheus":
+		// Prometheus pulls metrics, so it needs the handler of InitPrometheusMeter.
+		return nil, errors.New("the prometheus metrics exporter is served by InitPrometheusMeter")
+	default:
+		return nil, fmt.Errorf("unsupported metrics exporter %q", name)
+	}
+}
+
+// newGCPExporter creates the google exporter. Tests replace it to simulate
+// credential errors.
+var newGCPExporter = func() (sdktrace.SpanExporter, error) {
+	return texporter.New()
+}
+
+// createGCPExporter creates the google exporter. When no Google Cloud credentials
+// are found, as on a developer machine, it falls back to the exporter named by
+// TELEMETRY_GCP_FALLBACK_EXPORTER, or fails with an error explaining how to pick
+// another exporter.
+func createGCPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	exporter, err := newGCPExporter()
+	if err == nil || !isMissingGCPCredentials(err) {
+		return exporter, err
+	}
+	if fallback := gcpFallbackExporter(); fallback != "" {
+		slog.Warn("no Google Cloud credentials found, using the fallback traces exporter", "exporter", fallback, "error", err)
+		return createTraceExporter(ctx, fallback)
+	}
+	return nil, fmt.Errorf("no Google Cloud credentials found for the default gcp traces exporter; "+
+		"outside Google Cloud set OTEL_TRACES_EXPORTER=console or none, "+
+		"or %s=console to fall back automatically: %w", gcpFallbackExporterEnv, err)
+}
+
+// gcpFallbackExporter returns the exporters named by
+// TELEMETRY_GCP_FALLBACK_EXPORTER without gcp, which would fall back again.
+func gcpFallbackExporter() ExporterType {
+	var names []string
+	for _, name := range strings.Split(os.Getenv(gcpFallbackExporterEnv), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == string(ExporterGCP) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return ExporterType(strings.Join(names, ","))
+}
+
+// isMissingGCPCredentials reports whether err comes from the lookup of the
+// application default credentials or of the project they belong to. The google
+// exporter does not wrap these errors, so they are recognized by their message.
+func isMissingGCPCredentials(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "could not find default credentials") ||
+		strings.Contains(msg, "no project found with application default credentials")
+}
+
+// consoleCompactEnv selects the output format of ExporterConsole.
+const consoleCompactEnv = "OTEL_CONSOLE_COMPACT"
+
+// consoleWriter receives the output of ExporterConsole. Tests replace it.
+var consoleWriter io.Writer = os.Stdout
+
+// createConsoleExporter creates the console exporter. It writes one compact JSON
+// line per span, which log scrapers expect, unless OTEL_CONSOLE_COMPACT is false,
+// which pretty-prints the JSON over several lines for reading in a terminal.
+func createConsoleExporter() (sdktrace.SpanExporter, error) {
+	opts := []stdouttrace.Option{stdouttrace.WithWriter(consoleWriter)}
+	if value := strings.TrimSpace(os.Getenv(consoleCompactEnv)); value != "" {
+		compact, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("invalid "+consoleCompactEnv+", using compact output", "value", value)
+		} else if !compact {
+			opts = append(opts, stdouttrace.WithPrettyPrint())
+		}
+	}
+	return stdouttrace.New(opts...)
+}
+
+// noopExporter discards every span, for ExporterNone.
+type noopExporter struct{}
+
+func (noopExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error { return nil }
+func (noopExporter) Shutdown(context.Context) error                             { return nil }
+
+// createOTLPExporter creates an OTLP exporter over HTTP, or over gRPC when
+// OTEL_EXPORTER_OTLP_PROTOCOL is "grpc". The endpoint and other settings are read
+// from the standard OTEL_EXPORTER_OTLP_* variables. Endpoints may be full URLs or
+// plain host:port values, which use TLS unless OTEL_EXPORTER_OTLP_INSECURE is true.
+func createOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch protocol := otlpProtocolFromEnv(); protocol {
+	case "http/protobuf":
+		return createOTLPHTTPExporter(ctx)
+	case "grpc":
+		return createOTLPGRPCExporter(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+func createOTLPHTTPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	tlsConfig, err := otlpTLSConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []otlptracehttp.Option
+	endpoint := otlpTracesEndpointFromEnv()
+	if strings.Contains(endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	} else if endpoint != "" {
+		host, path, _ := strings.Cut(endpoint, "/")
+		path = "/" + path
+		if path == "/" {
+			path = otlpTracesPath
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(host), otlptracehttp.WithURLPath(path))
+	}
+	if !strings.Contains(endpoint, "://") && otlpInsecureFromEnv() {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	}
+	if headers := otlpHeadersFromEnv(); len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	opts = append(opts, otlptracehttp.WithCompression(otlpCompressionFromEnv()))
+	if timeout, ok := otlpTimeoutFromEnv(); ok {
+		opts = append(opts, otlptracehttp.WithTimeout(timeout))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// createOTLPGRPCExporter creates an OTLP/gRPC exporter. Unlike HTTP, the endpoint
+// has no signal path.
+func createOTLPGRPCExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	tlsConfig, err := otlpTLSConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []otlptracegrpc.Option
+	endpoint := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"))
+	if strings.Contains(endpoint, "://") {
+		opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+	} else if endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+	}
+	if !strings.Contains(endpoint, "://") && otlpInsecureFromEnv() {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else if tlsConfig != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	if headers := otlpHeadersFromEnv(); len(headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(headers))
+	}
+	if otlpCompressionFromEnv() == otlptracehttp.GzipCompression {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	if timeout, ok := otlpTimeoutFromEnv(); ok {
+		opts = append(opts, otlptracegrpc.WithTimeout(timeout))
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
+
+// otlpProtocolFromEnv returns the OTLP transport, "http/protobuf" by default.
+func otlpProtocolFromEnv() string {
+	value := firstEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	if protocol := strings.ToLower(strings.TrimSpace(value)); protocol != "" {
+		return protocol
+	}
+	return "http/protobuf"
+}
+
+// Signal paths appended to a base OTLP/HTTP endpoint.
+const (
+	otlpTracesPath  = "/v1/traces"
+	otlpMetricsPath = "/v1/metrics"
+)
+
+// otlpTracesEndpointFromEnv returns the traces URL derived from the environment.
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used as is. OTEL_EXPORTER_OTLP_ENDPOINT is
+// a base URL that gets the traces path appended, unless it already ends with it,
+// which avoids a doubled /v1/traces/v1/traces path.
+func otlpTracesEndpointFromEnv() string {
+	return otlpEndpointFromEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", otlpTracesPath)
+}
+
+// otlpEndpointFromEnv returns the URL of a signal: the signal-specific variable
+// as is, or OTEL_EXPORTER_OTLP_ENDPOINT with path appended.
+func otlpEndpointFromEnv(signalKey, path string) string {
+	if endpoint := strings.TrimSpace(os.Getenv(signalKey)); endpoint != "" {
+		return endpoint
+	}
+	endpoint := strings.TrimRight(strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")), "/")
+	if endpoint == "" || strings.HasSuffix(endpoint, path) {
+		return endpoint
+	}
+	return endpoint + path
+}
+
+// otlpCompressionFromEnv reads OTEL_EXPORTER_OTLP_COMPRESSION. Only gzip is
+// supported; anything else disables compression.
+func otlpCompressionFromEnv() otlptracehttp.Compression {
+	value := firstEnv("OTEL_EXPORTER_OTLP_TRACES_COMPRESSION", "OTEL_EXPORTER_OTLP_COMPRESSION")
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "gzip":
+		return otlptracehttp.GzipCompression
+	case "", "none":
+		return otlptracehttp.NoCompression
+	default:
+		slog.Warn("unsupported OTLP compression, defaulting to none", "compression", value)
+		return otlptracehttp.NoCompression
+	}
+}
+
+// otlpInsecureFromEnv reports whether OTEL_EXPORTER_OTLP_TRACES_INSECURE, or else
+// OTEL_EXPORTER_OTLP_INSECURE, disables TLS. It only applies to endpoints without
+// a scheme; the scheme of a URL decides on its own.
+func otlpInsecureFromEnv() bool {
+	value := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE"))
+	if value == "" {
+		return false
+	}
+	insecure, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("invalid OTEL_EXPORTER_OTLP_INSECURE, using TLS", "value", value)
+		return false
+	}
+	return insecure
+}
+
+// otlpTLSConfigFromEnv builds the TLS configuration of the OTLP exporter from the
+// PEM files named by OTEL_EXPORTER_OTLP_CERTIFICATE, the CA that signed the
+// collector's certificate, and OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE with
+// OTEL_EXPORTER_OTLP_CLIENT_KEY, the certificate presented for mTLS. Each has a
+// TRACES_ variant that takes precedence. It returns nil when none is set, so the
+// system roots are used. Unreadable files are errors rather than a silent fallback
+// to a connection the collector would reject.
+func otlpTLSConfigFromEnv() (*tls.Config, error) {
+	caFile := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_CERTIFICATE", "OTEL_EXPORTER_OTLP_CERTIFICATE"))
+	certFile := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_CLIENT_CERTIFICATE", "OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"))
+	keyFile := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_CLIENT_KEY", "OTEL_EXPORTER_OTLP_CLIENT_KEY"))
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTLP CA certificate: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in OTLP CA certificate %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("OTLP client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// otlpHeadersFromEnv reads the headers sent with each export, such as the API key
+// of a managed collector, from OTEL_EXPORTER_OTLP_TRACES_HEADERS or else
+// OTEL_EXPORTER_OTLP_HEADERS. The value is a comma-separated list of key=value
+// pairs whose values may be percent-encoded. Invalid pairs log a warning and are
+// skipped. The value of a header is never logged.
+func otlpHeadersFromEnv() map[string]string {
+	value := firstEnv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS")
+	headers := make(map[string]string)
+	for i, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			// Without a valid key, the pair may be a pasted secret, so only its
+			// position is logged.
+			slog.Warn("skipping invalid OTLP header", "index", i)
+			continue
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(val))
+		if err != nil {
+			slog.Warn("skipping OTLP header with an invalid encoding", "key", key)
+			continue
+		}
+		headers[key] = decoded
+	}
+	return headers
+}
+
+// otlpTimeoutFromEnv reads the export timeout in milliseconds from
+// OTEL_EXPORTER_OTLP_TIMEOUT. It returns false when the variable is unset or
+// invalid, in which case the SDK default applies.
+func otlpTimeoutFromEnv() (time.Duration, bool) {
+	value := strings.TrimSpace(firstEnv("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"))
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		slog.Warn("invalid OTLP timeout, using the default", "timeout", value)
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// firstEnv returns the value of the first environment variable that is set.
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+	}
+	return ""
+}
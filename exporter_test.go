@@ -0,0 +1,515 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// newOTLPTestServer returns a test server that records every OTLP export
+// request it receives.
+func newOTLPTestServer(t *testing.T) (*httptest.Server, <-chan *http.Request) {
+	t.Helper()
+	requests := make(chan *http.Request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Clone(context.Background())
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func exportTestSpan(t *testing.T, ctx context.Context) error {
+	t.Helper()
+	exporter, err := createOTLPExporter(ctx)
+	require.NoError(t, err)
+	defer exporter.Shutdown(ctx)
+
+	stub := tracetest.SpanStub{
+		Name: "test-span",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{0x01},
+			SpanID:  trace.SpanID{0x02},
+		}),
+	}
+	return exporter.ExportSpans(ctx, tracetest.SpanStubs{stub}.Snapshots())
+}
+
+func TestOTLPExporterCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		wantHeader  string
+	}{
+		{name: "gzip", compression: "gzip", wantHeader: "gzip"},
+		{name: "default is none", compression: "", wantHeader: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newOTLPTestServer(t)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+			t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", tt.compression)
+
+			require.NoError(t, exportTestSpan(t, context.Background()))
+			require.Equal(t, tt.wantHeader, (<-requests).Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestOTLPExporterEndpoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		endpoint       string
+		tracesEndpoint string
+		// schemeless passes the traces endpoint as host:port and path.
+		schemeless bool
+		wantPath   string
+	}{
+		{name: "base endpoint", endpoint: "", wantPath: "/v1/traces"},
+		{name: "base endpoint with trailing slash", endpoint: "/", wantPath: "/v1/traces"},
+		{name: "base endpoint with prefix", endpoint: "/otlp", wantPath: "/otlp/v1/traces"},
+		{name: "full signal url", endpoint: "/v1/traces", wantPath: "/v1/traces"},
+		{name: "traces endpoint used as is", tracesEndpoint: "/custom/traces", wantPath: "/custom/traces"},
+		{name: "bare traces endpoint", tracesEndpoint: "/", schemeless: true, wantPath: "/v1/traces"},
+		{name: "bare traces endpoint with path", tracesEndpoint: "/custom/traces", schemeless: true, wantPath: "/custom/traces"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newOTLPTestServer(t)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL+tt.endpoint)
+			if tt.schemeless {
+				t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+				t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", strings.TrimPrefix(srv.URL, "http://")+strings.TrimSuffix(tt.tracesEndpoint, "/"))
+			} else if tt.tracesEndpoint != "" {
+				t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", srv.URL+tt.tracesEndpoint)
+			}
+
+			require.NoError(t, exportTestSpan(t, context.Background()))
+			require.Equal(t, tt.wantPath, (<-requests).URL.Path)
+		})
+	}
+}
+
+func TestOTLPExporterTimeout(t *testing.T) {
+	// The server holds each request until the client gives up on it and
+	// reports how long that took.
+	held := make(chan time.Duration, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// The body must be consumed for the server to notice the client going away
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		held <- time.Since(start)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "100")
+
+	// Bound the retries so the export itself returns quickly
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Error(t, exportTestSpan(t, ctx))
+	require.Less(t, <-held, 500*time.Millisecond)
+}
+
+func TestOTLPTimeoutFromEnv(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "250", want: 250 * time.Millisecond, wantOK: true},
+		{value: "abc", wantOK: false},
+		{value: "-1", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", tt.value)
+			got, ok := otlpTimeoutFromEnv()
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOTLPHeadersFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		signal  string
+		generic string
+		want    map[string]string
+	}{
+		{name: "unset", want: map[string]string{}},
+		{
+			name:    "generic",
+			generic: "api-key=secret, x-tenant=acme",
+			want:    map[string]string{"api-key": "secret", "x-tenant": "acme"},
+		},
+		{
+			name:    "signal specific wins",
+			signal:  "api-key=traces",
+			generic: "api-key=secret,x-tenant=acme",
+			want:    map[string]string{"api-key": "traces"},
+		},
+		{
+			name:    "percent-encoded value",
+			generic: "authorization=Basic%20dXNlcjpwYXNz",
+			want:    map[string]string{"authorization": "Basic dXNlcjpwYXNz"},
+		},
+		{
+			name:    "invalid entries are skipped",
+			generic: "api-key=secret,missing-equals,=empty-key,bad key=x,bad-encoding=%zz",
+			want:    map[string]string{"api-key": "secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", tt.signal)
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", tt.generic)
+			if tt.signal == "" {
+				require.NoError(t, os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS"))
+			}
+			require.Equal(t, tt.want, otlpHeadersFromEnv())
+		})
+	}
+}
+
+func TestOTLPHeadersFromEnvDoesNotLogSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization:Bearer xyz,api key=secret,api-key=%zz-secret")
+
+	require.Empty(t, otlpHeadersFromEnv())
+	require.Len(t, logEntries(t, &buf), 3)
+	require.NotContains(t, buf.String(), "xyz")
+	require.NotContains(t, buf.String(), "secret")
+}
+
+func TestOTLPExporterHeaders(t *testing.T) {
+	srv, requests := newOTLPTestServer(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret")
+
+	require.NoError(t, exportTestSpan(t, context.Background()))
+	require.Equal(t, "secret", (<-requests).Header.Get("Api-Key"))
+}
+
+// writeTestClientCertificate writes a self-signed client certificate and its key
+// as PEM files and returns their paths with the parsed certificate.
+func writeTestClientCertificate(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "telemetry-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, cert
+}
+
+func TestOTLPExporterTLS(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Clone(context.Background())
+	}))
+	certFile, keyFile, clientCert := writeTestClientCertificate(t)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	srv.TLS.ClientCAs.AddCert(clientCert)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	serverPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, serverPEM, 0o600))
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_CERTIFICATE", caFile)
+	t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", certFile)
+	t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_KEY", keyFile)
+
+	require.NoError(t, exportTestSpan(t, context.Background()))
+	got := <-requests
+	require.Len(t, got.TLS.PeerCertificates, 1)
+	require.Equal(t, "telemetry-test-client", got.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+func TestOTLPExporterInsecure(t *testing.T) {
+	srv, requests := newOTLPTestServer(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+
+	require.NoError(t, exportTestSpan(t, context.Background()))
+	require.Equal(t, "/v1/traces", (<-requests).URL.Path)
+}
+
+func TestOTLPTLSConfigFromEnvErrors(t *testing.T) {
+	certFile, keyFile, _ := writeTestClientCertificate(t)
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "missing CA file", env: map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": "/nonexistent/ca.pem"}},
+		{name: "CA file without certificate", env: map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": keyFile}},
+		{name: "client certificate without key", env: map[string]string{"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE": certFile}},
+		{name: "traces variable wins", env: map[string]string{
+			"OTEL_EXPORTER_OTLP_CERTIFICATE":        certFile,
+			"OTEL_EXPORTER_OTLP_TRACES_CERTIFICATE": "/nonexistent/ca.pem",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := createOTLPExporter(context.Background())
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestConsoleExporterFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		compact    string
+		wantPretty bool
+	}{
+		{name: "default is compact", compact: ""},
+		{name: "compact", compact: "true"},
+		{name: "pretty", compact: "false", wantPretty: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			prev := consoleWriter
+			consoleWriter = &buf
+			t.Cleanup(func() { consoleWriter = prev })
+			t.Setenv(consoleCompactEnv, tt.compact)
+
+			exporter, err := createTraceExporter(context.Background(), ExporterConsole)
+			require.NoError(t, err)
+			stub := tracetest.SpanStub{Name: "test-span"}
+			require.NoError(t, exporter.ExportSpans(context.Background(), tracetest.SpanStubs{stub}.Snapshots()))
+
+			output := strings.TrimSpace(buf.String())
+			require.True(t, json.Valid([]byte(output)))
+			require.Equal(t, tt.wantPretty, strings.Contains(output, "\n"))
+		})
+	}
+}
+
+func TestExporterNameFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		signal  string
+		generic string
+		want    string
+	}{
+		{name: "default", want: ""},
+		{name: "generic fallback", generic: "otlp", want: "otlp"},
+		{name: "signal specific wins", signal: "GCP", generic: "otlp", want: "gcp"},
+		{name: "blank signal falls back", signal: " ", generic: "otlp", want: "otlp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tt.signal)
+			t.Setenv("OTEL_EXPORTER", tt.generic)
+			require.Equal(t, tt.want, exporterNameFromEnv("OTEL_TRACES_EXPORTER"))
+		})
+	}
+}
+
+func TestGCPExporterMissingCredentials(t *testing.T) {
+	prev := newGCPExporter
+	t.Cleanup(func() { newGCPExporter = prev })
+	newGCPExporter = func() (sdktrace.SpanExporter, error) {
+		// The message returned by the google exporter outside Google Cloud
+		return nil, errors.New("stackdriver: google: could not find default credentials. See https://cloud.google.com/docs/authentication/external/set-up-adc for more information")
+	}
+
+	t.Run("actionable error", func(t *testing.T) {
+		t.Setenv(gcpFallbackExporterEnv, "")
+		_, err := createTraceExporter(context.Background(), ExporterGCP)
+		require.ErrorContains(t, err, "OTEL_TRACES_EXPORTER=console or none")
+		require.ErrorContains(t, err, gcpFallbackExporterEnv+"=console")
+		require.ErrorContains(t, err, "could not find default credentials")
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		t.Setenv(gcpFallbackExporterEnv, "none")
+		exporter, err := createTraceExporter(context.Background(), ExporterGCP)
+		require.NoError(t, err)
+		require.IsType(t, noopExporter{}, exporter)
+	})
+
+	t.Run("gcp in the fallback list", func(t *testing.T) {
+		t.Setenv(gcpFallbackExporterEnv, "none,gcp")
+		exporter, err := createTraceExporter(context.Background(), ExporterGCP)
+		require.NoError(t, err)
+		require.IsType(t, noopExporter{}, exporter)
+
+		t.Setenv(gcpFallbackExporterEnv, "gcp")
+		_, err = createTraceExporter(context.Background(), ExporterGCP)
+		require.ErrorContains(t, err, "could not find default credentials")
+	})
+
+	t.Run("other errors unchanged", func(t *testing.T) {
+		t.Setenv(gcpFallbackExporterEnv, "none")
+		newGCPExporter = func() (sdktrace.SpanExporter, error) {
+			return nil, errors.New("stackdriver: couldn't initiate trace client: dial failed")
+		}
+		_, err := createTraceExporter(context.Background(), ExporterGCP)
+		require.EqualError(t, err, "stackdriver: couldn't initiate trace client: dial failed")
+	})
+}
+
+// failingExporter fails every export and records whether it was shut down.
+type failingExporter struct {
+	shutdown bool
+}
+
+func (e *failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("backend unavailable")
+}
+
+func (e *failingExporter) Shutdown(context.Context) error {
+	e.shutdown = true
+	return nil
+}
+
+func TestMultiExporter(t *testing.T) {
+	t.Run("from env", func(t *testing.T) {
+		t.Setenv("OTEL_TRACES_EXPORTER", "none, console")
+		exporter, err := createTraceExporter(context.Background(), "")
+		require.NoError(t, err)
+		require.IsType(t, multiExporter{}, exporter)
+		require.Len(t, exporter, 2)
+		require.Equal(t, noopExporter{}, exporter.(multiExporter)[0])
+	})
+
+	t.Run("invalid entry", func(t *testing.T) {
+		_, err := createTraceExporter(context.Background(), "none,bogus")
+		require.ErrorContains(t, err, `bogus: unsupported traces exporter "bogus"`)
+	})
+
+	t.Run("fan out", func(t *testing.T) {
+		first, second := tracetest.NewInMemoryExporter(), tracetest.NewInMemoryExporter()
+		failing := &failingExporter{}
+		exporter := multiExporter{first, failing, second}
+
+		stub := tracetest.SpanStub{Name: "test-span"}
+		err := exporter.ExportSpans(context.Background(), tracetest.SpanStubs{stub}.Snapshots())
+		require.EqualError(t, err, "backend unavailable")
+		require.Len(t, first.GetSpans(), 1)
+		require.Len(t, second.GetSpans(), 1, "a failing exporter does not block the others")
+
+		require.NoError(t, exporter.Shutdown(context.Background()))
+		require.True(t, failing.shutdown)
+	})
+}
+
+// grpcTraceReceiver records the spans exported to it over OTLP/gRPC.
+type grpcTraceReceiver struct {
+	collectortrace.UnimplementedTraceServiceServer
+	requests chan *collectortrace.ExportTraceServiceRequest
+}
+
+func (r *grpcTraceReceiver) Export(_ context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	r.requests <- req
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func TestOTLPExporterProtocol(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	receiver := &grpcTraceReceiver{requests: make(chan *collectortrace.ExportTraceServiceRequest, 10)}
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, receiver)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	for _, endpoint := range []string{"http://" + lis.Addr().String(), lis.Addr().String()} {
+		t.Run("grpc "+endpoint, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+
+			require.NoError(t, exportTestSpan(t, context.Background()))
+			req := <-receiver.requests
+			require.Equal(t, "test-span", req.GetResourceSpans()[0].GetScopeSpans()[0].GetSpans()[0].GetName())
+		})
+	}
+
+	t.Run("http host and port", func(t *testing.T) {
+		httpSrv, requests := newOTLPTestServer(t)
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", strings.TrimPrefix(httpSrv.URL, "http://"))
+		t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+
+		require.NoError(t, exportTestSpan(t, context.Background()))
+		require.Equal(t, "/v1/traces", (<-requests).URL.Path)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+		_, err := createOTLPExporter(context.Background())
+		require.ErrorContains(t, err, `unsupported OTLP protocol "http/json"`)
+	})
+}
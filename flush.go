@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// errorFlushTimeout bounds a flush triggered by an error span or log.
+const errorFlushTimeout = 5 * time.Second
+
+// activeErrorFlusher is set by InitTracer when WithFlushOnError is used, so the
+// log handler can trigger a flush for error logs.
+var activeErrorFlusher atomic.Pointer[errorFlusher]
+
+// errorFlusher force flushes the tracer provider at most once per interval.
+type errorFlusher struct {
+	interval time.Duration
+	flush    func(context.Context) error
+	clock    clock
+	last     atomic.Int64
+}
+
+func newErrorFlusher(interval time.Duration, flush func(context.Context) error) *errorFlusher {
+	return &errorFlusher{interval: interval, flush: flush, clock: wallClock{}}
+}
+
+// maybeFlush flushes unless a flush already happened within the interval.
+func (f *errorFlusher) maybeFlush(ctx context.Context) {
+	now := f.clock.Now().UnixNano()
+	last := f.last.Load()
+	if last != 0 && now-last < int64(f.interval) {
+		return
+	}
+	if !f.last.CompareAndSwap(last, now) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), errorFlushTimeout)
+	defer cancel()
+	_ = f.flush(ctx)
+}
+
+// flushOnErrorLog flushes pending spans after an error-level log when
+// WithFlushOnError is enabled.
+func flushOnErrorLog(ctx context.Context) {
+	if f := activeErrorFlusher.Load(); f != nil {
+		f.maybeFlush(ctx)
+	}
+}
+
+// flushOnErrorProcessor flushes the provider whenever a span with an error status ends.
+type flushOnErrorProcessor struct {
+	flusher *errorFlusher
+}
+
+func (p *flushOnErrorProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *flushOnErrorProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.Status().Code == codes.Error {
+		p.flusher.maybeFlush(context.Background())
+	}
+}
+
+func (p *flushOnErrorProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (p *flushOnErrorProcessor) ForceFlush(context.Context) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFlushOnErrorProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	var tp *sdktrace.TracerProvider
+	flushes := 0
+	flusher := newErrorFlusher(time.Hour, func(ctx context.Context) error {
+		flushes++
+		return tp.ForceFlush(ctx)
+	})
+	tp = sdktrace.NewTracerProvider(
+		// A long batch timeout so spans are only exported by a flush
+		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithBatchTimeout(time.Hour))),
+		sdktrace.WithSpanProcessor(&flushOnErrorProcessor{flusher: flusher}),
+	)
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	ok.End()
+	require.Empty(t, exporter.GetSpans())
+
+	_, failed := tracer.Start(context.Background(), "failed")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	require.Len(t, exporter.GetSpans(), 2)
+	require.Equal(t, 1, flushes)
+
+	// A second error within the interval does not flush again
+	_, again := tracer.Start(context.Background(), "again")
+	again.SetStatus(codes.Error, "boom")
+	again.End()
+	require.Equal(t, 1, flushes)
+	require.Len(t, exporter.GetSpans(), 2)
+}
@@ -0,0 +1,102 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus otelcodes.Code
+	}{
+		{name: "ok", err: nil, wantStatus: otelcodes.Unset},
+		{name: "client error", err: status.Error(codes.NotFound, "missing"), wantStatus: otelcodes.Unset},
+		{name: "server error", err: status.Error(codes.Internal, "boom"), wantStatus: otelcodes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.Pairs("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01")
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+			info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Items/Get"}
+
+			var handlerSpan trace.SpanContext
+			_, err := UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				handlerSpan = trace.SpanContextFromContext(ctx)
+				return nil, tt.err
+			})
+			require.Equal(t, tt.err, err)
+
+			ended := recorder.Ended()
+			span := ended[len(ended)-1]
+			require.Equal(t, "pkg.Items/Get", span.Name())
+			require.Equal(t, trace.SpanKindServer, span.SpanKind())
+			require.Equal(t, "0102030405060708090a0b0c0d0e0f10", span.SpanContext().TraceID().String())
+			require.Equal(t, span.SpanContext(), handlerSpan)
+			require.Subset(t, span.Attributes(), []attribute.KeyValue{
+				attribute.String("server.type", "grpc"),
+				attribute.String("rpc.service", "pkg.Items"),
+				attribute.String("rpc.method", "Get"),
+				attribute.Int64("rpc.grpc.status_code", int64(status.Code(tt.err))),
+			})
+			require.Equal(t, tt.wantStatus, span.Status().Code)
+		})
+	}
+}
+
+func TestUnaryServerInterceptorSuppressed(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Items/Get"}
+
+	_, err := UnaryServerInterceptor()(SuppressSpans(context.Background()), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, recorder.Ended())
+}
+
+// testServerStream is a grpc.ServerStream that only carries a context.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Items/Watch", IsServerStream: true}
+	stream := &testServerStream{ctx: context.Background()}
+
+	err := StreamServerInterceptor()(nil, stream, info, func(srv any, ss grpc.ServerStream) error {
+		require.True(t, trace.SpanFromContext(ss.Context()).IsRecording())
+		return errors.New("stream broke")
+	})
+	require.Error(t, err)
+
+	require.Len(t, recorder.Ended(), 1)
+	span := recorder.Ended()[0]
+	require.Equal(t, "pkg.Items/Watch", span.Name())
+	require.Equal(t, otelcodes.Error, span.Status().Code, "plain errors map to Unknown")
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingTransport wraps base so outgoing requests carry the trace context of
+// their request context in a traceparent header, and each request is recorded as
+// a client span. A nil base uses http.DefaultTransport. The opts are passed to
+// otelhttp.NewTransport. Trace an existing client with:
+//
+//	client.Transport = telemetry.NewTracingTransport(nil)
+func NewTracingTransport(base http.RoundTripper, opts ...otelhttp.Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base, opts...)
+}
+
+// ClientTrace returns an httptrace.ClientTrace that records DNS, connection, TLS
+// and first-byte timings as events on the span in ctx. It matches the signature
+// expected by otelhttp.WithClientTrace, which calls it with the client span:
+//
+//	transport := otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithClientTrace(telemetry.ClientTrace))
+func ClientTrace(ctx context.Context) *httptrace.ClientTrace {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return &httptrace.ClientTrace{}
+	}
+
+	ct := &clientTrace{span: span, starts: make(map[string]time.Time)}
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			ct.start("dns", "", attribute.String("net.host.name", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			ct.done("dns", "", info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			ct.start("connect", addr, attribute.String("network.transport", network), attribute.String("net.peer.addr", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			ct.done("connect", addr, err, attribute.String("net.peer.addr", addr))
+		},
+		TLSHandshakeStart: func() {
+			ct.start("tls", "")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			ct.done("tls", "", err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			ct.span.AddEvent("http.got_conn", trace.WithAttributes(
+				attribute.Bool("reused", info.Reused),
+				attribute.Bool("was_idle", info.WasIdle),
+			))
+		},
+		GotFirstResponseByte: func() {
+			ct.span.AddEvent("http.first_byte")
+		},
+	}
+}
+
+// clientTrace pairs start and done callbacks, which may run concurrently when
+// several addresses are dialed at once.
+type clientTrace struct {
+	span trace.Span
+
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+func (c *clientTrace) start(phase, key string, attrs ...attribute.KeyValue) {
+	c.mu.Lock()
+	c.starts[phase+key] = time.Now()
+	c.mu.Unlock()
+	c.span.AddEvent("http."+phase+".start", trace.WithAttributes(attrs...))
+}
+
+func (c *clientTrace) done(phase, key string, err error, attrs ...attribute.KeyValue) {
+	c.mu.Lock()
+	start, ok := c.starts[phase+key]
+	delete(c.starts, phase+key)
+	c.mu.Unlock()
+
+	if ok {
+		attrs = append(attrs, attribute.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000))
+	}
+	// Errors are recorded on the event only: a failed dial may be followed by a
+	// successful one to another address, so it does not fail the request.
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	c.span.AddEvent("http."+phase+".done", trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestClientTrace(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithClientTrace(ClientTrace))}
+	// Use a host name so the request goes through a DNS lookup
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	require.Len(t, recorder.Ended(), 1)
+	events := map[string]bool{}
+	for _, event := range recorder.Ended()[0].Events() {
+		events[event.Name] = true
+	}
+	for _, name := range []string{"http.dns.start", "http.dns.done", "http.connect.start", "http.connect.done", "http.got_conn", "http.first_byte"} {
+		require.True(t, events[name], "missing event %s", name)
+	}
+}
+
+func TestNewTracingTransport(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	client := &http.Client{Transport: NewTracingTransport(nil)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	clientSpan := spans[0]
+	require.Equal(t, trace.SpanKindClient, clientSpan.SpanKind())
+	require.Equal(t, parent.SpanContext().SpanID(), clientSpan.Parent().SpanID())
+	require.Equal(t, "00-"+clientSpan.SpanContext().TraceID().String()+"-"+clientSpan.SpanContext().SpanID().String()+"-01", traceparent)
+}
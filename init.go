@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// InitConfig configures Init.
+type InitConfig struct {
+	ServiceName string
+
+	// LogLevel and LogFormat are passed to SetupLoggingWithWriter.
+	LogLevel  string
+	LogFormat string
+	// LogWriter receives the logs. It defaults to os.Stdout.
+	LogWriter      io.Writer
+	LoggingOptions []LoggingOption
+
+	TracerOptions []TracerOption
+}
+
+// Subsystem statuses reported by the lifecycle logs of Init.
+const (
+	statusOK      = "ok"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// Init sets up logging, tracing and metrics in one call. It logs "telemetry
+// initialized" with the elapsed time and the status of each subsystem, and the
+// returned function, which shuts tracing and metrics down, logs "telemetry shut
+// down" in the same way. A subsystem that fails to start does not prevent the
+// others from starting; its error is returned and it is skipped at shutdown.
+func Init(ctx context.Context, cfg InitConfig) (func(context.Context) error, error) {
+	start := time.Now()
+
+	w := cfg.LogWriter
+	if w == nil {
+		w = os.Stdout
+	}
+	SetupLoggingWithWriter(cfg.LogLevel, cfg.LogFormat, w, cfg.LoggingOptions...)
+
+	tracingShutdown, tracingErr := InitTracer(ctx, cfg.ServiceName, cfg.TracerOptions...)
+	metricsShutdown, metricsErr := InitMeter(ctx, cfg.ServiceName)
+	initErr := errors.Join(tracingErr, metricsErr)
+
+	attrs := []any{
+		"duration_ms", time.Since(start).Milliseconds(),
+		"logging", statusOK,
+		"tracing", initStatus(tracingErr),
+		"metrics", initStatus(metricsErr),
+	}
+	if initErr != nil {
+		slog.ErrorContext(ctx, "telemetry initialized", append(attrs, "error", initErr)...)
+	} else {
+		slog.InfoContext(ctx, "telemetry initialized", attrs...)
+	}
+
+	shutdown := func(ctx context.Context) error {
+		start := time.Now()
+		// Metrics go first so spans recorded while flushing them are still exported.
+		metricsStatus, metricsErr := runShutdown(ctx, metricsShutdown, metricsErr)
+		tracingStatus, tracingErr := runShutdown(ctx, tracingShutdown, tracingErr)
+		err := errors.Join(metricsErr, tracingErr)
+
+		attrs := []any{
+			"duration_ms", time.Since(start).Milliseconds(),
+			"logging", statusOK,
+			"tracing", tracingStatus,
+			"metrics", metricsStatus,
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "telemetry shut down", append(attrs, "error", err)...)
+		} else {
+			slog.InfoContext(ctx, "telemetry shut down", attrs...)
+		}
+		return err
+	}
+	return shutdown, initErr
+}
+
+func initStatus(err error) string {
+	if err != nil {
+		return statusFailed
+	}
+	return statusOK
+}
+
+// runShutdown shuts down a subsystem unless it failed to initialize.
+func runShutdown(ctx context.Context, shutdown func(context.Context) error, initErr error) (string, error) {
+	if initErr != nil || shutdown == nil {
+		return statusSkipped, nil
+	}
+	if err := shutdown(ctx); err != nil {
+		return statusFailed, err
+	}
+	return statusOK, nil
+}
+
+// DefaultShutdownTimeout bounds Shutdown when it is given no timeout.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// Shutdown calls shutdownFn, such as the function returned by InitTracer or Init,
+// with a context that expires after timeout, or DefaultShutdownTimeout when
+// timeout is not positive. It keeps a process from hanging on termination while
+// an unreachable collector is retried: the exporters give up when the context
+// expires, and spans not exported by then are lost. A nil shutdownFn is a no-op.
+func Shutdown(shutdownFn func(context.Context) error, timeout time.Duration) error {
+	if shutdownFn == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return shutdownFn(ctx)
+}
@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestInit(t *testing.T) {
+	srv, _ := newOTLPTestServer(t)
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	// An unsupported exporter makes metrics fail while tracing starts
+	t.Setenv("OTEL_METRICS_EXPORTER", "bogus")
+
+	prevTracer, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTracer)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	var buf bytes.Buffer
+	shutdown, err := Init(context.Background(), InitConfig{
+		ServiceName: "test-service",
+		LogLevel:    "info",
+		LogFormat:   "json",
+		LogWriter:   &buf,
+	})
+	require.ErrorContains(t, err, `unsupported metrics exporter "bogus"`)
+	require.NoError(t, shutdown(context.Background()))
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 3)
+	require.Equal(t, "batch span processor configured", entries[0]["message"])
+
+	started := entries[1]
+	require.Equal(t, "telemetry initialized", started["message"])
+	require.Equal(t, "ERROR", started["severity"])
+	require.Equal(t, statusOK, started["logging"])
+	require.Equal(t, statusOK, started["tracing"])
+	require.Equal(t, statusFailed, started["metrics"])
+	require.Contains(t, started, "duration_ms")
+
+	stopped := entries[2]
+	require.Equal(t, "telemetry shut down", stopped["message"])
+	require.Equal(t, "INFO", stopped["severity"])
+	require.Equal(t, statusOK, stopped["logging"])
+	require.Equal(t, statusOK, stopped["tracing"])
+	require.Equal(t, statusSkipped, stopped["metrics"])
+	require.Contains(t, stopped, "duration_ms")
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		wantTimeout time.Duration
+	}{
+		{name: "given timeout", timeout: time.Second, wantTimeout: time.Second},
+		{name: "default timeout", timeout: 0, wantTimeout: DefaultShutdownTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var remaining time.Duration
+			err := Shutdown(func(ctx context.Context) error {
+				deadline, ok := ctx.Deadline()
+				require.True(t, ok)
+				remaining = time.Until(deadline)
+				return nil
+			}, tt.timeout)
+			require.NoError(t, err)
+			require.InDelta(t, tt.wantTimeout, remaining, float64(100*time.Millisecond))
+		})
+	}
+
+	t.Run("hanging shutdown", func(t *testing.T) {
+		err := Shutdown(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, 10*time.Millisecond)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	require.NoError(t, Shutdown(nil, 0))
+}
@@ -5,20 +5,64 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// LoggerNameKey is the attribute key that names a logger, as in
+// slog.With(LoggerNameKey, "db"). It labels the app.errors counter.
+const LoggerNameKey = "logger"
+
 // otelSlogHandler wraps a slog.Handler to automatically add OpenTelemetry trace context
 // This handler works with child loggers created using With()
 type otelSlogHandler struct {
-	handler slog.Handler
+	handler  slog.Handler
+	encoders []attrEncoder
+
+	errorCounter   metric.Int64Counter
+	errorPredicate func(slog.Record) bool
+	loggerName     string
+	grouped        bool
+
+	addPackage bool
 }
 
-func newOtelSlogHandler(handler slog.Handler) *otelSlogHandler {
-	return &otelSlogHandler{handler: handler}
+func newOtelSlogHandler(handler slog.Handler, cfg *loggingConfig) *otelSlogHandler {
+	h := &otelSlogHandler{
+		handler:    handler,
+		encoders:   cfg.encoders,
+		addPackage: cfg.addPackage,
+	}
+	if cfg.errorMetrics {
+		counter, err := otel.Meter(instrumentationName).Int64Counter("app.errors",
+			metric.WithDescription("Number of error logs"),
+			metric.WithUnit("{log}"),
+		)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create app.errors counter: %v\n", err)
+		} else {
+			h.errorCounter = counter
+			h.errorPredicate = cfg.errorPredicate
+		}
+	}
+	return h
+}
+
+// clone returns a copy of h that delegates to handler.
+func (h *otelSlogHandler) clone(handler slog.Handler) *otelSlogHandler {
+	c := *h
+	c.handler = handler
+	return &c
 }
 
 func (h *otelSlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
@@ -26,6 +70,9 @@ func (h *otelSlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
 }
 
 func (h *otelSlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.Enabled(ctx, record.Level) {
+		return nil
+	}
 	// Get the SpanContext from the context and add trace attributes
 	// following Cloud Logging structured log format described in:
 	// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
@@ -36,62 +83,375 @@ func (h *otelSlogHandler) Handle(ctx context.Context, record slog.Record) error
 			slog.Bool("logging.googleapis.com/trace_sampled", s.TraceFlags().IsSampled()),
 		)
 	}
-	return h.handler.Handle(ctx, record)
+	if id, ok := TransactionIDFromContext(ctx); ok {
+		record.AddAttrs(slog.String(string(TransactionIDKey), id))
+	}
+	if highThroughputMode.Load() {
+		// Without a program counter, the source and package are not resolved.
+		record.PC = 0
+	}
+	if h.addPackage {
+		if pkg := packageFromPC(record.PC); pkg != "" {
+			record.AddAttrs(slog.String("package", pkg))
+		}
+	}
+	if len(h.encoders) > 0 {
+		record = h.encodeRecord(record)
+	}
+	if h.errorCounter != nil && h.errorPredicate(record) {
+		h.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String(LoggerNameKey, h.loggerName)))
+	}
+	err := h.handler.Handle(ctx, record)
+	if record.Level >= slog.LevelError {
+		flushOnErrorLog(ctx)
+	}
+	return err
 }
 
 func (h *otelSlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &otelSlogHandler{handler: h.handler.WithAttrs(attrs)}
+	c := h.clone(h.handler.WithAttrs(h.encodeAttrs(attrs)))
+	if !h.grouped {
+		for _, a := range attrs {
+			if a.Key == LoggerNameKey {
+				c.loggerName = a.Value.String()
+			}
+		}
+	}
+	return c
 }
 
 func (h *otelSlogHandler) WithGroup(name string) slog.Handler {
-	return &otelSlogHandler{handler: h.handler.WithGroup(name)}
+	c := h.clone(h.handler.WithGroup(name))
+	c.grouped = true
+	return c
+}
+
+// attrEncoder converts attribute values of a given type before they are serialized.
+type attrEncoder struct {
+	typ    reflect.Type
+	encode func(any) slog.Value
+}
+
+// encodeRecord returns a copy of record with the registered encoders applied to its attributes.
+func (h *otelSlogHandler) encodeRecord(record slog.Record) slog.Record {
+	encoded := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		encoded.AddAttrs(h.encodeAttr(a))
+		return true
+	})
+	return encoded
+}
+
+func (h *otelSlogHandler) encodeAttrs(attrs []slog.Attr) []slog.Attr {
+	if len(h.encoders) == 0 {
+		return attrs
+	}
+	encoded := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		encoded[i] = h.encodeAttr(a)
+	}
+	return encoded
+}
+
+func (h *otelSlogHandler) encodeAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		a.Value = slog.GroupValue(h.encodeAttrs(a.Value.Group())...)
+		return a
+	}
+	v := a.Value.Any()
+	if v == nil {
+		return a
+	}
+	typ := reflect.TypeOf(v)
+	// Exact type matches take precedence over interface matches
+	for _, enc := range h.encoders {
+		if enc.typ == typ {
+			a.Value = enc.encode(v)
+			return a
+		}
+	}
+	for _, enc := range h.encoders {
+		if enc.typ.Kind() == reflect.Interface && typ.Implements(enc.typ) {
+			a.Value = enc.encode(v)
+			return a
+		}
+	}
+	return a
+}
+
+// highThroughputMode is set by SetHighThroughputMode.
+var highThroughputMode atomic.Bool
+
+// SetHighThroughputMode trades detail for speed under high log volume. When
+// enabled, logs have no source location or package attribute, and spans created
+// by Tracer.Span are named after the tracer only, without looking up the caller.
+// It takes effect immediately for existing loggers and tracers.
+func SetHighThroughputMode(enabled bool) {
+	highThroughputMode.Store(enabled)
+}
+
+// LoggingOption configures SetupLogging and SetupLoggingWithWriter.
+type LoggingOption func(*loggingConfig)
+
+type loggingConfig struct {
+	encoders       []attrEncoder
+	errorMetrics   bool
+	errorPredicate func(slog.Record) bool
+	addPackage     bool
+	handlers       []slog.Handler
+}
+
+// WithHandlers also sends every record to handlers, for example a text handler
+// on the console next to the JSON output. The records already carry the trace
+// fields, but the Cloud Logging key renames only apply to the main output.
+func WithHandlers(handlers ...slog.Handler) LoggingOption {
+	return func(c *loggingConfig) {
+		c.handlers = append(c.handlers, handlers...)
+	}
+}
+
+// WithPackageAttribute adds a package attribute with the import path of the
+// function that emitted the log, taken from the same program counter slog uses
+// for the source location.
+func WithPackageAttribute() LoggingOption {
+	return func(c *loggingConfig) {
+		c.addPackage = true
+	}
+}
+
+// packageFromPC returns the import path of the function at pc, for example
+// "github.com/polymerdao/telemetry" for "github.com/polymerdao/telemetry.(*tracer).Span".
+func packageFromPC(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	fn := frame.Function
+	if fn == "" {
+		return ""
+	}
+	lastSlash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[lastSlash+1:], "."); dot != -1 {
+		return fn[:lastSlash+1+dot]
+	}
+	return fn
+}
+
+// WithErrorMetrics counts logs matching predicate in an app.errors counter on the
+// global MeterProvider, labeled with the logger name (see LoggerNameKey). A nil
+// predicate matches records at error level and above. Errors logged under a sampled
+// span link to it through an exemplar, as controlled by the standard
+// OTEL_METRICS_EXEMPLAR_FILTER variable (trace_based by default).
+func WithErrorMetrics(predicate func(slog.Record) bool) LoggingOption {
+	return func(c *loggingConfig) {
+		if predicate == nil {
+			predicate = func(r slog.Record) bool { return r.Level >= slog.LevelError }
+		}
+		c.errorMetrics = true
+		c.errorPredicate = predicate
+	}
+}
+
+// WithAttrEncoder registers an encoder for attribute values of type T. If T is an
+// interface type, the encoder applies to every value implementing it, unless an
+// encoder for the exact type is also registered.
+func WithAttrEncoder[T any](encode func(T) slog.Value) LoggingOption {
+	return func(c *loggingConfig) {
+		c.encoders = append(c.encoders, attrEncoder{
+			typ:    reflect.TypeFor[T](),
+			encode: func(v any) slog.Value { return encode(v.(T)) },
+		})
+	}
+}
+
+// EncodeError renders an error as a group with its message and dynamic type.
+// Use it with WithAttrEncoder.
+func EncodeError(err error) slog.Value {
+	return slog.GroupValue(
+		slog.String("message", err.Error()),
+		slog.String("type", fmt.Sprintf("%T", err)),
+	)
+}
+
+// EncodeDurationMillis renders a duration as a number of milliseconds.
+// Use it with WithAttrEncoder.
+func EncodeDurationMillis(d time.Duration) slog.Value {
+	return slog.Float64Value(float64(d) / float64(time.Millisecond))
 }
 
 func replacer(groups []string, a slog.Attr) slog.Attr {
+	// Only the built-in top-level keys are renamed; attributes inside groups
+	// may reuse the same names and must be left untouched.
+	if len(groups) > 0 {
+		return a
+	}
 	// Rename attribute keys to match Cloud Logging structured log format
 	switch a.Key {
 	case slog.LevelKey:
 		a.Key = "severity"
-		// Map slog.Level string values to Cloud Logging LogSeverity
-		// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
-		if level := a.Value.Any().(slog.Level); level == slog.LevelWarn {
-			a.Value = slog.StringValue("WARNING")
-		}
+		a.Value = slog.StringValue(cloudLoggingSeverity(a.Value.Any().(slog.Level)))
 	case slog.TimeKey:
 		a.Key = "timestamp"
 	case slog.MessageKey:
 		a.Key = "message"
+	case slog.SourceKey:
+		// Records without a program counter, as in high throughput mode, have an
+		// empty source, which is omitted.
+		if src, ok := a.Value.Any().(*slog.Source); ok && *src == (slog.Source{}) {
+			return slog.Attr{}
+		}
+		// The source keeps its function, file and line fields, as expected by
+		// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+		a.Key = "logging.googleapis.com/sourceLocation"
 	}
 	return a
 }
 
-func SetupLogging(level, format string) {
-	SetupLoggingWithWriter(level, format, os.Stdout)
+// cloudLoggingSeverity maps a slog level to a Cloud Logging LogSeverity, see
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity.
+// Levels between the named slog levels, such as slog.LevelInfo+2, take the
+// severity of the level below them, and levels above error are CRITICAL.
+func cloudLoggingSeverity(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	case level == slog.LevelError:
+		return "ERROR"
+	default:
+		return "CRITICAL"
+	}
+}
+
+// SetupLogging sets the default slog logger to write logs at or above level to
+// os.Stdout, as JSON when format is "json" and as text otherwise, with the trace
+// context of each record and Cloud Logging field names.
+func SetupLogging(level, format string, options ...LoggingOption) {
+	SetupLoggingWithWriter(level, format, os.Stdout, options...)
+}
+
+// SetupLoggingWithWriter is like SetupLogging but writes to w, such as a file or
+// a buffer in tests.
+func SetupLoggingWithWriter(level, format string, w io.Writer, options ...LoggingOption) {
+	defaultLogLevel.Set(parseLogLevel(level))
+	// Set this logger as the global slog logger.
+	slog.SetDefault(newLogger(LoggingConfig{
+		Format:  format,
+		Writer:  w,
+		Options: options,
+	}, &defaultLogLevel))
+}
+
+// defaultLogLevel is the level of the logger set up by SetupLogging, which the
+// log level endpoint of DebugHandler changes at runtime.
+var defaultLogLevel slog.LevelVar
+
+// LoggingConfig configures NewLogger.
+type LoggingConfig struct {
+	// Level is the minimum level, such as "debug" or "warn". It defaults to info.
+	Level string
+	// Format is "json" or "text", the default.
+	Format string
+	// Writer receives the logs. It defaults to os.Stdout.
+	Writer  io.Writer
+	Options []LoggingOption
+}
+
+// NewLogger returns a logger configured like the one set up by SetupLogging,
+// without changing the default logger. It lets several services in one binary,
+// such as an integration test, log to their own writer. Attach it to a context
+// with ContextWithLogger.
+func NewLogger(config LoggingConfig) *slog.Logger {
+	return newLogger(config, parseLogLevel(config.Level))
 }
 
-func SetupLoggingWithWriter(level, format string, w io.Writer) {
-	var lvl slog.Level
-	if err := lvl.UnmarshalText([]byte(level)); err != nil {
-		fmt.Fprintf(os.Stderr, "invalid log level %q, defaulting to info: %v\n", level, err)
-		lvl = slog.LevelInfo
+// parseLogLevel parses a level name such as "debug", defaulting to info.
+func parseLogLevel(level string) slog.Level {
+	lvl := slog.LevelInfo
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid log level %q, defaulting to info: %v\n", level, err)
+			lvl = slog.LevelInfo
+		}
 	}
+	return lvl
+}
+
+// newLogger is NewLogger with the level given as a slog.Leveler, which may change
+// after the logger is created. config.Level is ignored.
+func newLogger(config LoggingConfig, level slog.Leveler) *slog.Logger {
+	cfg := &loggingConfig{}
+	for _, opt := range config.Options {
+		opt(cfg)
+	}
+
+	w := config.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	// The level only applies to the main output; the handlers of WithHandlers
+	// keep their own levels.
+	var handler slog.Handler = &leveledHandler{Handler: newFormatHandler(w, config.Format), level: level}
+	if len(cfg.handlers) > 0 {
+		handler = MultiHandler(append([]slog.Handler{handler}, cfg.handlers...)...)
+	}
+
+	// Wrap with our OpenTelemetry-aware handler that works with child loggers
+	return slog.New(newOtelSlogHandler(handler, cfg))
+}
 
+// leveledHandler drops the records below level, unless the context overrides
+// it with WithLogLevel.
+type leveledHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	minLevel, ok := logLevelFromContext(ctx)
+	if !ok {
+		minLevel = h.level.Level()
+	}
+	return level >= minLevel && h.Handler.Enabled(ctx, level)
+}
+
+func (h *leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *leveledHandler) WithGroup(name string) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// newFormatHandler returns a JSON or text handler writing to w with Cloud
+// Logging field names. It accepts every level.
+func newFormatHandler(w io.Writer, format string) slog.Handler {
 	opts := &slog.HandlerOptions{
-		Level:       lvl,
+		// The level is checked by leveledHandler, which lets WithLogLevel lower it.
+		Level:       slog.Level(math.MinInt),
 		ReplaceAttr: replacer,
 		AddSource:   true,
 	}
-
-	var handler slog.Handler
 	if strings.ToLower(format) == "json" {
-		handler = slog.NewJSONHandler(w, opts)
-	} else {
-		handler = slog.NewTextHandler(w, opts)
+		return slog.NewJSONHandler(w, opts)
 	}
+	return slog.NewTextHandler(w, opts)
+}
 
-	// Wrap with our OpenTelemetry-aware handler that works with child loggers
-	otelHandler := newOtelSlogHandler(handler)
+// LogTypeKey is the attribute distinguishing the records of NewAuditLogger, whose
+// value is "audit", from application logs.
+const LogTypeKey = attribute.Key("log.type")
 
-	// Set this handler as the global slog handler.
-	slog.SetDefault(slog.New(otelHandler))
+// NewAuditLogger returns a logger for audit events, which usually have their own
+// retention and sink. It writes every record to w as JSON with the trace context
+// and LogTypeKey set to "audit", whatever the level configured by SetupLogging or
+// WithLogLevel.
+func NewAuditLogger(w io.Writer) *slog.Logger {
+	h := newOtelSlogHandler(newFormatHandler(w, "json"), &loggingConfig{})
+	return slog.New(h).With(string(LogTypeKey), "audit")
 }
@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -37,9 +44,12 @@ func TestSetupLogging(t *testing.T) {
 	pc, file, _, ok := runtime.Caller(0)
 	require.True(t, ok)
 
-	require.Equal(t, file, logEntry["source"].(map[string]any)["file"])
-	require.Equal(t, runtime.FuncForPC(pc).Name(), logEntry["source"].(map[string]any)["function"])
-	require.NotEmpty(t, logEntry["source"].(map[string]any)["line"])
+	require.NotContains(t, logEntry, "source")
+	source, ok := logEntry["logging.googleapis.com/sourceLocation"].(map[string]any)
+	require.True(t, ok, "Expected sourceLocation field")
+	require.Equal(t, file, source["file"])
+	require.Equal(t, runtime.FuncForPC(pc).Name(), source["function"])
+	require.NotEmpty(t, source["line"])
 }
 
 func TestHandlerWithSpanContext(t *testing.T) {
@@ -70,3 +80,255 @@ func TestHandlerWithSpanContext(t *testing.T) {
 	require.Equal(t, "0200000000000000", logEntry["logging.googleapis.com/spanId"].(string))
 	require.True(t, logEntry["logging.googleapis.com/trace_sampled"].(bool))
 }
+
+type point struct{ X, Y int }
+
+func TestAttrEncoders(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf,
+		WithAttrEncoder(func(p point) slog.Value { return slog.StringValue(fmt.Sprintf("(%d,%d)", p.X, p.Y)) }),
+		WithAttrEncoder(EncodeError),
+		WithAttrEncoder(EncodeDurationMillis),
+	)
+
+	slog.With("origin", point{0, 0}).Info("test message",
+		"point", point{1, 2},
+		"error", errors.New("boom"),
+		slog.Group("request", "elapsed", 1500*time.Millisecond),
+	)
+
+	var logEntry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logEntry))
+
+	require.Equal(t, "(0,0)", logEntry["origin"])
+	require.Equal(t, "(1,2)", logEntry["point"])
+	require.Equal(t, map[string]any{"message": "boom", "type": "*errors.errorString"}, logEntry["error"])
+	require.Equal(t, 1500.0, logEntry["request"].(map[string]any)["elapsed"])
+}
+
+func TestErrorMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf, WithErrorMetrics(func(r slog.Record) bool {
+		return r.Level >= slog.LevelError && r.Message != "ignored"
+	}))
+
+	logger := slog.With(LoggerNameKey, "db")
+	logger.Info("not an error")
+	logger.Error("query failed")
+	logger.Error("query failed again")
+	logger.Error("ignored")
+	slog.Error("no logger name")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	m := rm.ScopeMetrics[0].Metrics[0]
+	require.Equal(t, "app.errors", m.Name)
+	counts := map[string]int64{}
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		name, _ := dp.Attributes.Value(LoggerNameKey)
+		counts[name.AsString()] = dp.Value
+	}
+	require.Equal(t, map[string]int64{"db": 2, "": 1}, counts)
+}
+
+func TestErrorMetricsExemplarFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		filter        string
+		wantExemplars int
+	}{
+		{name: "default is trace based", filter: "", wantExemplars: 1},
+		{name: "trace based", filter: "trace_based", wantExemplars: 1},
+		{name: "always off", filter: "always_off", wantExemplars: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The metric SDK reads the filter when the provider is created
+			t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", tt.filter)
+			reader := sdkmetric.NewManualReader()
+			prev := otel.GetMeterProvider()
+			otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+			t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+			var buf bytes.Buffer
+			SetupLoggingWithWriter("info", "json", &buf, WithErrorMetrics(nil))
+
+			traceID := trace.TraceID{0x01}
+			sampled := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     trace.SpanID{0x02},
+				TraceFlags: trace.FlagsSampled,
+			}))
+			slog.ErrorContext(sampled, "failed under a sampled span")
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+			dps := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints
+			require.Len(t, dps, 1)
+			require.Len(t, dps[0].Exemplars, tt.wantExemplars)
+			if tt.wantExemplars > 0 {
+				require.Equal(t, traceID[:], dps[0].Exemplars[0].TraceID)
+			}
+		})
+	}
+}
+
+func TestPackageAttribute(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf, WithPackageAttribute())
+
+	slog.Info("test message")
+
+	var logEntry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logEntry))
+	require.Equal(t, "github.com/polymerdao/telemetry", logEntry["package"])
+
+	require.Empty(t, packageFromPC(0))
+}
+
+func TestReplacerWithGroups(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	slog.Default().WithGroup("request").Warn("test message", "level", "high", "time", "later", "msg", "inner")
+
+	var logEntry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logEntry))
+
+	require.Equal(t, "WARNING", logEntry["severity"])
+	require.Equal(t, "test message", logEntry["message"])
+	require.Contains(t, logEntry, "timestamp")
+	require.Equal(t, map[string]any{"level": "high", "time": "later", "msg": "inner"}, logEntry["request"])
+}
+
+func TestSeverityMapping(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{level: slog.LevelDebug - 4, want: "DEBUG"},
+		{level: slog.LevelDebug, want: "DEBUG"},
+		{level: slog.LevelInfo, want: "INFO"},
+		{level: slog.LevelInfo + 2, want: "INFO"},
+		{level: slog.LevelWarn, want: "WARNING"},
+		{level: slog.LevelError, want: "ERROR"},
+		{level: slog.LevelError + 1, want: "CRITICAL"},
+		{level: slog.LevelError + 4, want: "CRITICAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			SetupLoggingWithWriter("debug-4", "json", &buf)
+
+			slog.Log(context.Background(), tt.level, "test message")
+
+			var logEntry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &logEntry))
+			require.Equal(t, tt.want, logEntry["severity"])
+		})
+	}
+}
+
+func TestWithLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	slog.DebugContext(context.Background(), "hidden")
+	slog.DebugContext(WithLogLevel(context.Background(), slog.LevelDebug), "scoped debug")
+	slog.InfoContext(WithLogLevel(context.Background(), slog.LevelWarn), "silenced info")
+	slog.InfoContext(context.Background(), "regular info")
+
+	var messages []string
+	for _, entry := range logEntries(t, &buf) {
+		messages = append(messages, entry["message"].(string))
+	}
+	require.Equal(t, []string{"scoped debug", "regular info"}, messages)
+}
+
+func TestNewLogger(t *testing.T) {
+	var defaultBuf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &defaultBuf)
+
+	var orders, payments bytes.Buffer
+	ordersLogger := NewLogger(LoggingConfig{Level: "debug", Format: "json", Writer: &orders})
+	paymentsLogger := NewLogger(LoggingConfig{Format: "json", Writer: &payments})
+
+	ordersLogger.Debug("order created")
+	paymentsLogger.Debug("hidden at the default info level")
+	paymentsLogger.Info("payment captured")
+
+	require.Len(t, logEntries(t, &orders), 1)
+	require.Equal(t, "order created", logEntries(t, &orders)[0]["message"])
+	require.Len(t, logEntries(t, &payments), 1)
+	require.Equal(t, "payment captured", logEntries(t, &payments)[0]["message"])
+	require.Zero(t, defaultBuf.Len(), "the default logger is unchanged")
+}
+
+func TestHighThroughputMode(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf, WithPackageAttribute())
+	SetHighThroughputMode(true)
+	t.Cleanup(func() { SetHighThroughputMode(false) })
+
+	slog.Info("test message")
+
+	var logEntry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logEntry))
+	require.Equal(t, "test message", logEntry["message"])
+	require.NotContains(t, logEntry, "logging.googleapis.com/sourceLocation")
+	require.NotContains(t, logEntry, "source")
+	require.NotContains(t, logEntry, "package")
+
+	recorder := setTestTracerProvider(t)
+	_, span := newTracer("bench").Span(context.Background())
+	span.End()
+	require.Equal(t, "bench", recorder.Ended()[0].Name(), "the caller is not looked up")
+}
+
+func BenchmarkLogging(b *testing.B) {
+	for _, highThroughput := range []bool{false, true} {
+		b.Run(fmt.Sprintf("high_throughput=%t", highThroughput), func(b *testing.B) {
+			SetupLoggingWithWriter("info", "json", io.Discard)
+			SetHighThroughputMode(highThroughput)
+			defer SetHighThroughputMode(false)
+			ctx := context.Background()
+			b.ReportAllocs()
+			for b.Loop() {
+				slog.InfoContext(ctx, "request handled", "status", 200)
+			}
+		})
+	}
+}
+
+func TestNewAuditLogger(t *testing.T) {
+	var appBuf, auditBuf bytes.Buffer
+	SetupLoggingWithWriter("error", "text", &appBuf)
+	audit := NewAuditLogger(&auditBuf)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := WithLogLevel(trace.ContextWithSpanContext(context.Background(), sc), slog.LevelError)
+	slog.InfoContext(ctx, "application log")
+	audit.DebugContext(ctx, "role granted", "user", "alice")
+
+	require.Zero(t, appBuf.Len())
+	entries := logEntries(t, &auditBuf)
+	require.Len(t, entries, 1)
+	require.Equal(t, "role granted", entries[0]["message"])
+	require.Equal(t, "audit", entries[0][string(LogTypeKey)])
+	require.Equal(t, "alice", entries[0]["user"])
+	require.Equal(t, sc.TraceID().String(), entries[0]["logging.googleapis.com/trace"])
+}
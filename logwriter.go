@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogWriter returns an io.Writer for libraries that only accept a writer for
+// their logs. Each newline-delimited line written to it becomes one record at
+// the given level on the default logger. Partial writes are buffered until the
+// line is complete; a partial line longer than 64 KiB is logged in pieces of that
+// size so the buffer stays bounded.
+func LogWriter(level slog.Level) io.Writer {
+	return LogWriterContext(context.Background(), level)
+}
+
+// LogWriterContext is like LogWriter but logs every record with ctx, so records
+// carry the trace context of the span active in ctx.
+func LogWriterContext(ctx context.Context, level slog.Level) io.Writer {
+	return &logWriter{ctx: ctx, level: level}
+}
+
+// maxLogWriterLine caps the partial line a logWriter buffers.
+const maxLogWriterLine = 64 << 10
+
+type logWriter struct {
+	ctx   context.Context
+	level slog.Level
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(w.buf[:i], []byte("\r"))
+		w.buf = w.buf[i+1:]
+		if len(line) > 0 {
+			w.log(string(line))
+		}
+	}
+	// Flush a partial line past the cap rather than buffering it without bound
+	if len(w.buf) > maxLogWriterLine {
+		for len(w.buf) > maxLogWriterLine {
+			w.log(string(w.buf[:maxLogWriterLine]))
+			w.buf = w.buf[maxLogWriterLine:]
+		}
+		w.buf = bytes.Clone(w.buf)
+	}
+	// Release the backing array once everything has been consumed
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) log(msg string) {
+	handler := slog.Default().Handler()
+	if !handler.Enabled(w.ctx, w.level) {
+		return
+	}
+	// A zero PC omits the source, which would otherwise point at this writer
+	// rather than at the library that produced the line.
+	_ = handler.Handle(w.ctx, slog.NewRecord(time.Now(), w.level, msg, 0))
+}
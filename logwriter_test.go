@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x02},
+	})
+	w := LogWriterContext(trace.ContextWithSpanContext(context.Background(), sc), slog.LevelWarn)
+
+	// The first line is split across two writes
+	_, err := fmt.Fprint(w, "first ")
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+	_, err = fmt.Fprint(w, "line\nsecond line\n")
+	require.NoError(t, err)
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 2)
+	require.Equal(t, "first line", entries[0]["message"])
+	require.Equal(t, "second line", entries[1]["message"])
+	for _, entry := range entries {
+		require.Equal(t, "WARNING", entry["severity"])
+		require.Equal(t, sc.TraceID().String(), entry["logging.googleapis.com/trace"])
+	}
+}
+
+func TestLogWriterLongLine(t *testing.T) {
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	w := LogWriter(slog.LevelInfo).(*logWriter)
+	_, err := w.Write(bytes.Repeat([]byte("a"), maxLogWriterLine+10))
+	require.NoError(t, err)
+	require.Len(t, w.buf, 10, "only the rest past the cap stays buffered")
+	_, err = fmt.Fprint(w, "\n")
+	require.NoError(t, err)
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 2)
+	require.Len(t, entries[0]["message"], maxLogWriterLine)
+	require.Len(t, entries[1]["message"], 10)
+}
@@ -0,0 +1,38 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// InitMeter initializes the global OpenTelemetry MeterProvider with the same
+// resource as InitTracer. The exporter is selected by OTEL_METRICS_EXPORTER
+// ("gcp" by default, "otlp", "console" or "none"), and metrics are exported
+// periodically, every OTEL_METRIC_EXPORT_INTERVAL milliseconds (60s by default).
+// The returned function flushes pending metrics and closes the reader.
+func InitMeter(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	res, err := GetResource(ctx, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	exporter, err := createMetricExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	}
+	mp := sdkmetric.NewMeterProvider(opts...)
+
+	// Set the global MeterProvider
+	otel.SetMeterProvider(mp)
+
+	// Shutting down the provider flushes and shuts down its reader and exporter.
+	return mp.Shutdown, nil
+}
@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestInitMeter(t *testing.T) {
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	t.Run("otlp", func(t *testing.T) {
+		srv, requests := newOTLPTestServer(t)
+		t.Setenv("OTEL_METRICS_EXPORTER", "otlp")
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+
+		shutdown, err := InitMeter(context.Background(), "test-service")
+		require.NoError(t, err)
+		counter, err := otel.Meter("test").Int64Counter("jobs")
+		require.NoError(t, err)
+		counter.Add(context.Background(), 1)
+
+		// Shutdown flushes the periodic reader
+		require.NoError(t, shutdown(context.Background()))
+		require.Equal(t, "/v1/metrics", (<-requests).URL.Path)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		t.Setenv("OTEL_METRICS_EXPORTER", "none")
+		shutdown, err := InitMeter(context.Background(), "test-service")
+		require.NoError(t, err)
+		require.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("prometheus", func(t *testing.T) {
+		t.Setenv("OTEL_METRICS_EXPORTER", "prometheus")
+		_, err := InitMeter(context.Background(), "test-service")
+		require.ErrorContains(t, err, "InitPrometheusMeter")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		t.Setenv("OTEL_METRICS_EXPORTER", "statsd")
+		_, err := InitMeter(context.Background(), "test-service")
+		require.ErrorContains(t, err, `unsupported metrics exporter "statsd"`)
+	})
+}
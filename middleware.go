@@ -2,54 +2,722 @@ package telemetry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/felixge/httpsnoop"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// SampleRateHeader is the default header read by WithSampleRateHeader.
+	SampleRateHeader = "X-Trace-Sample-Rate"
+	// TraceIDHeader is the response header set by WithTraceResponseHeaders.
+	TraceIDHeader = "X-Trace-Id"
+	// SpanIDHeader is the response header carrying the span ID when enabled.
+	SpanIDHeader = "X-Span-Id"
+)
+
+// redactedValue replaces the value of redacted keys in logged request bodies.
+const redactedValue = "[REDACTED]"
+
+// MiddlewareOption configures TracingMiddlewareWithOptions.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	otelOpts         []otelhttp.Option
+	bodyLogging      *bodyLoggingConfig
+	sampleRateHeader string
+	accessLog        *AccessLogConfig
+	responseHeaders  *responseHeaderConfig
+	maxSpanNames     int
+	spanNameBodyMax  int64
+	ignoredPaths     []string
+	debugMetricAttr  bool
+	slo              *SLOConfig
+	metricLimit      int
+	handlerName      bool
+	headerCounts     bool
+}
+
+// SLOConfig defines which requests count as good for WithSLOMetrics.
+type SLOConfig struct {
+	// LatencyThreshold is the maximum duration of a good request.
+	LatencyThreshold time.Duration
+	// GoodStatus reports whether a response status counts as good. When nil,
+	// every status below 500 is good.
+	GoodStatus func(status int) bool
+}
+
+// sloCounters records the requests.good and requests.total counters.
+type sloCounters struct {
+	cfg          SLOConfig
+	good         metric.Int64Counter
+	total        metric.Int64Counter
+	goodLimiter  *cardinalityLimiter
+	totalLimiter *cardinalityLimiter
+}
+
+// AccessLogConfig controls the fields written by WithAccessLog.
+type AccessLogConfig struct {
+	// IncludeSpanID adds the server span ID next to the trace ID.
+	IncludeSpanID bool
+	// IncludeSampled adds whether the server span was sampled.
+	IncludeSampled bool
+	// IncludeTraceState adds the W3C tracestate of the server span, when it has one.
+	IncludeTraceState bool
+}
+
+type responseHeaderConfig struct {
+	includeSpanID bool
+}
+
+type bodyLoggingConfig struct {
+	routes     map[string]struct{}
+	maxBytes   int
+	redactKeys map[string]struct{}
+}
+
+// WithOtelHTTPOptions passes additional options to the underlying otelhttp handler.
+func WithOtelHTTPOptions(opts ...otelhttp.Option) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.otelOpts = append(c.otelOpts, opts...)
+	}
+}
+
+// WithBodyLogging logs the JSON request body at debug level for the listed routes.
+// Values of keys in redactKeys (case-insensitive, at any depth) are replaced before
+// logging. At most maxBytes of the body are read for logging and the logged body is
+// truncated to maxBytes; a negative maxBytes reads and logs the whole body. The
+// handler still receives the full, unmodified body.
+func WithBodyLogging(routes []string, maxBytes int, redactKeys []string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		cfg := &bodyLoggingConfig{
+			routes:     make(map[string]struct{}, len(routes)),
+			maxBytes:   maxBytes,
+			redactKeys: make(map[string]struct{}, len(redactKeys)),
+		}
+		for _, route := range routes {
+			cfg.routes[route] = struct{}{}
+		}
+		for _, key := range redactKeys {
+			cfg.redactKeys[strings.ToLower(key)] = struct{}{}
+		}
+		c.bodyLogging = cfg
+	}
+}
+
+// WithSampleRateHeader lets clients override the sampling ratio of a request by
+// sending a value in [0, 1] in the given header (SampleRateHeader when empty).
+// It is meant for load tests and only takes effect when enabled is true, so it
+// can be tied to a deployment flag rather than exposed in production.
+func WithSampleRateHeader(header string, enabled bool) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		if !enabled {
+			c.sampleRateHeader = ""
+			return
+		}
+		if header == "" {
+			header = SampleRateHeader
+		}
+		c.sampleRateHeader = header
+	}
+}
+
+// WithAccessLog writes one info-level log line per request with the method, path,
+// status, duration and trace ID of the server span.
+func WithAccessLog(cfg AccessLogConfig) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.accessLog = &cfg
+	}
+}
+
+// WithTraceResponseHeaders sets the TraceIDHeader response header, and SpanIDHeader
+// when includeSpanID is true, so clients can report the trace of a failed request.
+func WithTraceResponseHeaders(includeSpanID bool) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.responseHeaders = &responseHeaderConfig{includeSpanID: includeSpanID}
+	}
+}
+
+// WithMaxSpanNames caps the number of distinct server span names. Once max names
+// have been seen, requests that would create a new name are named OverflowSpanName,
+// which protects the backend from clients hitting many unique paths. It applies to
+// the default span name formatter only.
+func WithMaxSpanNames(max int) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.maxSpanNames = max
+	}
+}
+
+// defaultIgnoredPaths are the paths not traced unless WithIgnoredPaths is used.
+var defaultIgnoredPaths = []string{"/health"}
+
+// WithIgnoredPaths replaces the default /health path among the requests not
+// traced, typically health probes. Paths match exactly, unless they end with "*",
+// in which case they match as a prefix: "/debug/*" ignores every path under
+// /debug/. Repeated calls add to the list.
+func WithIgnoredPaths(paths ...string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.ignoredPaths = append(c.ignoredPaths, paths...)
+	}
+}
+
+// pathMatcher reports whether a request path is in a list of exact paths and
+// prefix patterns.
+type pathMatcher struct {
+	exact    map[string]struct{}
+	prefixes []string
+}
+
+func newPathMatcher(paths []string) *pathMatcher {
+	m := &pathMatcher{exact: make(map[string]struct{}, len(paths))}
+	for _, path := range paths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			m.prefixes = append(m.prefixes, prefix)
+		} else {
+			m.exact[path] = struct{}{}
+		}
+	}
+	return m
+}
+
+func (m *pathMatcher) match(path string) bool {
+	if _, ok := m.exact[path]; ok {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSpanNameBodyLimit caps the request body read by the default span name
+// formatter to find a JSON-RPC method at maxBytes, for example 4096. Bodies over
+// the cap, declared or read, and bodies whose Content-Type is not JSON are not
+// parsed, and the span is named after the HTTP method and path. By default the
+// whole body is read.
+func WithSpanNameBodyLimit(maxBytes int64) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.spanNameBodyMax = maxBytes
+	}
+}
+
+// WithDebugMetricAttribute adds a boolean debug attribute to the HTTP server
+// metrics recorded by the middleware. It is true when the request's trace is
+// sampled, so with a low base ratio it marks requests force-sampled for
+// debugging, for example through WithSampleRateHeader or a sampled parent.
+func WithDebugMetricAttribute() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.debugMetricAttr = true
+	}
+}
+
+// WithSLOMetrics counts every request in a requests.total counter on the global
+// MeterProvider, and requests that completed within cfg.LatencyThreshold with a
+// good status in requests.good, so their ratio can back a latency SLO. Requests
+// routed by an http.ServeMux carry its pattern as the http.route attribute.
+func WithSLOMetrics(cfg SLOConfig) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		if cfg.GoodStatus == nil {
+			cfg.GoodStatus = func(status int) bool { return status < http.StatusInternalServerError }
+		}
+		c.slo = &cfg
+	}
+}
+
+// WithMetricCardinalityLimit caps the number of distinct attribute sets, such as
+// http.route values, recorded for each of the SLO counters of WithSLOMetrics.
+// Requests past the limit are counted with every attribute set to OverflowValue.
+// Zero, the default, means no limit. The HTTP server metrics recorded by otelhttp
+// are not covered; limit them on the MeterProvider with
+// sdkmetric.WithCardinalityLimit.
+func WithMetricCardinalityLimit(limit int) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.metricLimit = limit
+	}
+}
+
+// WithHandlerNameAttribute records the name of the handler serving each request
+// as the http.handler span attribute. When the wrapped handler is an
+// *http.ServeMux, the handler matched for the request is named. Handler funcs are
+// named after their Go function, for example "main.listItems"; any other handler
+// falls back to its type name, such as "*main.itemsHandler".
+func WithHandlerNameAttribute() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.handlerName = true
+	}
+}
+
+// WithHeaderCountAttributes records the number of request and response header
+// values as the http.request.header_count and http.response.header_count span
+// attributes. Only counts are recorded, never the header values, which makes
+// requests with an unusual number of headers easy to spot.
+func WithHeaderCountAttributes() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headerCounts = true
+	}
+}
+
+// headerCount returns the number of values in h.
+func headerCount(h http.Header) int {
+	n := 0
+	for _, values := range h {
+		n += len(values)
+	}
+	return n
+}
+
 // TracingMiddleware wraps an http.Handler with OpenTelemetry tracing
 func TracingMiddleware(next http.Handler, opts ...otelhttp.Option) http.Handler {
+	return TracingMiddlewareWithOptions(next, WithOtelHTTPOptions(opts...))
+}
+
+// TracingMiddlewareWithOptions wraps an http.Handler with OpenTelemetry tracing,
+// configured by the given options.
+func TracingMiddlewareWithOptions(next http.Handler, opts ...MiddlewareOption) http.Handler {
+	cfg := &middlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	spanName := func(r *http.Request) string {
+		return truncateSpanName(spanNameFromRequest(r, cfg.spanNameBodyMax))
+	}
+	if cfg.maxSpanNames > 0 {
+		limiter := &spanNameLimiter{max: cfg.maxSpanNames, seen: make(map[string]struct{})}
+		spanName = func(r *http.Request) string {
+			return limiter.limit(truncateSpanName(spanNameFromRequest(r, cfg.spanNameBodyMax)))
+		}
+	}
+
+	ignoredPaths := cfg.ignoredPaths
+	if len(ignoredPaths) == 0 {
+		ignoredPaths = defaultIgnoredPaths
+	}
+	ignored := newPathMatcher(ignoredPaths)
+
 	// Default options
 	defaultOpts := []otelhttp.Option{
 		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
-			var request struct {
-				Method string `json:"method"`
-			}
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				return r.Method + " " + r.URL.Path
-			}
-			r.Body = io.NopCloser(bytes.NewReader(body))
-			if err := json.Unmarshal(body, &request); err != nil {
-				return r.Method + " " + r.URL.Path
-			}
-			return request.Method
+			return spanName(r)
 		}),
 		otelhttp.WithFilter(func(r *http.Request) bool {
 			// Don't trace health check endpoints
-			return r.URL.Path != "/health"
+			return !ignored.match(r.URL.Path)
 		}),
 		otelhttp.WithSpanOptions(trace.WithAttributes(
 			attribute.String("server.type", "http"),
 		)),
 	}
 
+	if cfg.debugMetricAttr {
+		defaultOpts = append(defaultOpts, otelhttp.WithMetricAttributesFn(func(r *http.Request) []attribute.KeyValue {
+			sampled := trace.SpanContextFromContext(r.Context()).IsSampled()
+			return []attribute.KeyValue{attribute.Bool("debug", sampled)}
+		}))
+	}
+
 	// Combine default options with custom options
-	allOpts := append(defaultOpts, opts...)
+	allOpts := append(defaultOpts, cfg.otelOpts...)
+
+	var slo *sloCounters
+	if cfg.slo != nil {
+		slo = newSLOCounters(*cfg.slo, cfg.metricLimit)
+	}
 
 	// Use the otelhttp handler with combined options
-	return otelhttp.NewHandler(
+	handler := otelhttp.NewHandler(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Keep the server span started by otelhttp for the access log and headers
+			serverCtx := r.Context()
+			sc := trace.SpanContextFromContext(serverCtx)
+			if cfg.responseHeaders != nil && sc.IsValid() {
+				w.Header().Set(TraceIDHeader, sc.TraceID().String())
+				if cfg.responseHeaders.includeSpanID {
+					w.Header().Set(SpanIDHeader, sc.SpanID().String())
+				}
+			}
+
+			if cfg.handlerName {
+				trace.SpanFromContext(serverCtx).SetAttributes(attribute.String("http.handler", handlerName(next, r)))
+			}
+
 			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-			next.ServeHTTP(w, r.WithContext(ctx))
+			r = r.WithContext(ctx)
+			if cfg.bodyLogging != nil {
+				cfg.bodyLogging.log(r)
+			}
+			// Only the access log and the SLO counters need the status code, so
+			// the writer is wrapped for them alone. httpsnoop keeps the optional
+			// interfaces of w, such as http.Flusher and http.Hijacker.
+			var m httpsnoop.Metrics
+			if cfg.accessLog == nil && slo == nil {
+				start := time.Now()
+				next.ServeHTTP(w, r)
+				m.Duration = time.Since(start)
+			} else {
+				m = httpsnoop.CaptureMetrics(next, w, r)
+			}
+			setResponseDuration(trace.SpanFromContext(serverCtx), m.Duration)
+			if cfg.headerCounts {
+				trace.SpanFromContext(serverCtx).SetAttributes(
+					attribute.Int("http.request.header_count", headerCount(r.Header)),
+					attribute.Int("http.response.header_count", headerCount(w.Header())),
+				)
+			}
+			if slo != nil {
+				slo.record(serverCtx, r, m)
+			}
+			if cfg.accessLog == nil {
+				return
+			}
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", m.Code,
+				"duration_ms", m.Duration.Milliseconds(),
+				"trace_id", sc.TraceID().String(),
+			}
+			if cfg.accessLog.IncludeSpanID {
+				attrs = append(attrs, "span_id", sc.SpanID().String())
+			}
+			if cfg.accessLog.IncludeSampled {
+				attrs = append(attrs, "sampled", sc.IsSampled())
+			}
+			if state := sc.TraceState().String(); cfg.accessLog.IncludeTraceState && state != "" {
+				attrs = append(attrs, "tracestate", state)
+			}
+			slog.InfoContext(serverCtx, "http request", attrs...)
 		}),
 		"http_server",
 		allOpts...,
 	)
+	if cfg.sampleRateHeader == "" {
+		return handler
+	}
+
+	// The sampling decision is made when otelhttp starts the span, so the
+	// override has to be placed on the context before that happens.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get(cfg.sampleRateHeader); value != "" {
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				slog.DebugContext(r.Context(), "ignoring invalid sample rate header", "header", cfg.sampleRateHeader, "value", value)
+			} else {
+				r = r.WithContext(contextWithSampleRate(r.Context(), rate))
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newSLOCounters(cfg SLOConfig, limit int) *sloCounters {
+	meter := otel.Meter(instrumentationName)
+	good, err := meter.Int64Counter("requests.good",
+		metric.WithDescription("Number of requests within the latency and status objective"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		slog.Warn("failed to create requests.good counter", "error", err)
+		return nil
+	}
+	total, err := meter.Int64Counter("requests.total",
+		metric.WithDescription("Number of requests"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		slog.Warn("failed to create requests.total counter", "error", err)
+		return nil
+	}
+	return &sloCounters{
+		cfg:          cfg,
+		good:         good,
+		total:        total,
+		goodLimiter:  newCardinalityLimiter(limit),
+		totalLimiter: newCardinalityLimiter(limit),
+	}
+}
+
+// record counts the request under the pattern of the ServeMux route that served
+// it, as the http.route attribute, when there is one.
+func (s *sloCounters) record(ctx context.Context, r *http.Request, m httpsnoop.Metrics) {
+	var attrs []attribute.KeyValue
+	if r.Pattern != "" {
+		attrs = append(attrs, attribute.String("http.route", r.Pattern))
+	}
+	s.total.Add(ctx, 1, metric.WithAttributeSet(s.totalLimiter.attributes(attrs...)))
+	if m.Duration <= s.cfg.LatencyThreshold && s.cfg.GoodStatus(m.Code) {
+		s.good.Add(ctx, 1, metric.WithAttributeSet(s.goodLimiter.attributes(attrs...)))
+	}
+}
+
+// handlerName names the handler that serves r, looking through a ServeMux.
+func handlerName(h http.Handler, r *http.Request) string {
+	if mux, ok := h.(*http.ServeMux); ok {
+		h, _ = mux.Handler(r)
+	}
+	if fn, ok := h.(http.HandlerFunc); ok {
+		if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// setResponseDuration records the duration of the handler on the server span.
+// otelhttp already sets the status code and the error status of the span.
+func setResponseDuration(span trace.Span, d time.Duration) {
+	span.SetAttributes(attribute.Float64("http.server.duration_ms", float64(d.Microseconds())/1000))
+}
+
+// spanNameFromRequest names the server span after the JSON-RPC method in the
+// request body, or the HTTP method and path when there is none. A positive
+// maxBody limits the body read, as described by WithSpanNameBodyLimit.
+func spanNameFromRequest(r *http.Request, maxBody int64) string {
+	fallback := r.Method + " " + r.URL.Path
+	var request struct {
+		Method string `json:"method"`
+	}
+	var body []byte
+	if maxBody > 0 {
+		if r.Body == nil || r.ContentLength > maxBody || !isJSONContentType(r.Header.Get("Content-Type")) {
+			return fallback
+		}
+		// Read one byte past the cap to tell a body of exactly maxBody bytes from a
+		// longer one, then put the bytes read back in front of the rest.
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > maxBody {
+			return fallback
+		}
+	} else {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return fallback
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return fallback
+	}
+	return request.Method
+}
+
+// isJSONContentType reports whether contentType is application/json or a
+// +json media type.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// OverflowSpanName replaces span names beyond the limit set by WithMaxSpanNames.
+const OverflowSpanName = "__other__"
+
+// spanNameLimiter bounds the number of distinct span names.
+type spanNameLimiter struct {
+	max int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func (l *spanNameLimiter) limit(name string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[name]; ok {
+		return name
+	}
+	if len(l.seen) >= l.max {
+		return OverflowSpanName
+	}
+	l.seen[name] = struct{}{}
+	return name
+}
+
+// log writes the redacted and truncated request body when the route is enabled.
+// The body is restored so the handler can read it again.
+func (c *bodyLoggingConfig) log(r *http.Request) {
+	if _, ok := c.routes[r.URL.Path]; !ok || r.Body == nil {
+		return
+	}
+	ctx := r.Context()
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	// Read at most maxBytes, plus one byte to tell whether the body is longer,
+	// then put the bytes read back in front of the rest for the handler.
+	var reader io.Reader = r.Body
+	if c.maxBytes >= 0 {
+		reader = io.LimitReader(r.Body, int64(c.maxBytes)+1)
+	}
+	body, err := io.ReadAll(reader)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		slog.DebugContext(ctx, "failed to read request body", "path", r.URL.Path, "error", err)
+		return
+	}
+
+	partial := c.maxBytes >= 0 && len(body) > c.maxBytes
+	redacted, err := c.redact(body, partial)
+	if err != nil {
+		slog.DebugContext(ctx, "request body is not valid JSON", "path", r.URL.Path, "size", len(body))
+		return
+	}
+
+	truncated := partial || c.maxBytes >= 0 && len(redacted) > c.maxBytes
+	if c.maxBytes >= 0 && len(redacted) > c.maxBytes {
+		redacted = redacted[:c.maxBytes]
+	}
+	slog.DebugContext(ctx, "request body",
+		"path", r.URL.Path,
+		"body", string(redacted),
+		"truncated", truncated,
+	)
+}
+
+// redact re-encodes the JSON in body with the values of configured keys replaced
+// at any depth. When partial is set, body is the start of a longer document and
+// the tokens decoded before it ends are encoded.
+func (c *bodyLoggingConfig) redact(body []byte, partial bool) ([]byte, error) {
+	// jsonScope is an object or array being encoded.
+	type jsonScope struct {
+		object    bool
+		values    int
+		expectKey bool
+		redact    bool
+	}
+	var (
+		out    bytes.Buffer
+		scopes []*jsonScope
+	)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	// separate writes the comma or colon before the next token of the scope.
+	separate := func() {
+		if len(scopes) == 0 {
+			return
+		}
+		scope := scopes[len(scopes)-1]
+		switch {
+		case scope.object && !scope.expectKey:
+			out.WriteByte(':')
+		case scope.values > 0:
+			out.WriteByte(',')
+		}
+	}
+	// ended records a complete value in the enclosing scope.
+	ended := func() {
+		if len(scopes) == 0 {
+			return
+		}
+		scope := scopes[len(scopes)-1]
+		scope.values++
+		scope.expectKey = scope.object
+		scope.redact = false
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && len(scopes) == 0 {
+			return out.Bytes(), nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			if partial && out.Len() > 0 {
+				return out.Bytes(), nil
+			}
+			return nil, err
+		}
+
+		var scope *jsonScope
+		if len(scopes) > 0 {
+			scope = scopes[len(scopes)-1]
+		}
+		if key, ok := tok.(string); ok && scope != nil && scope.object && scope.expectKey {
+			separate()
+			encoded, _ := json.Marshal(key)
+			out.Write(encoded)
+			scope.expectKey = false
+			_, scope.redact = c.redactKeys[strings.ToLower(key)]
+			continue
+		}
+
+		delim, isDelim := tok.(json.Delim)
+		if scope != nil && scope.redact {
+			separate()
+			encoded, _ := json.Marshal(redactedValue)
+			out.Write(encoded)
+			// Skip a redacted object or array as a whole.
+			for depth := 0; isDelim && (delim == '{' || delim == '[') || depth > 0; {
+				if isDelim {
+					if delim == '{' || delim == '[' {
+						depth++
+					} else {
+						depth--
+					}
+				}
+				if depth == 0 {
+					break
+				}
+				if tok, err = dec.Token(); err != nil {
+					return out.Bytes(), nil
+				}
+				delim, isDelim = tok.(json.Delim)
+			}
+			ended()
+			continue
+		}
+
+		switch {
+		case isDelim && (delim == '{' || delim == '['):
+			separate()
+			out.WriteByte(byte(delim))
+			scopes = append(scopes, &jsonScope{object: delim == '{', expectKey: delim == '{'})
+		case isDelim:
+			out.WriteByte(byte(delim))
+			scopes = scopes[:len(scopes)-1]
+			ended()
+		default:
+			separate()
+			encoded, err := json.Marshal(tok)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(encoded)
+			ended()
+		}
+	}
 }
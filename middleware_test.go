@@ -0,0 +1,546 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// logEntries parses newline-delimited JSON log output.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestTracingMiddlewareBodyLogging(t *testing.T) {
+	setTestTracerProvider(t)
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("debug", "json", &buf)
+
+	const body = `{"method":"eth_call","password":"hunter2","params":{"token":"s3cret","data":"0123456789abcdef"}}`
+	var received string
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			received = string(b)
+		}),
+		WithBodyLogging([]string{"/rpc"}, 80, []string{"password", "Token"}),
+	)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/other", strings.NewReader(body)))
+
+	require.Equal(t, body, received, "handler must receive the full body")
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1, "only listed routes are logged")
+	entry := entries[0]
+	require.Equal(t, "request body", entry["message"])
+	require.Equal(t, "/rpc", entry["path"])
+	require.Equal(t, true, entry["truncated"])
+	require.NotEmpty(t, entry["logging.googleapis.com/trace"])
+
+	logged := entry["body"].(string)
+	require.Len(t, logged, 80)
+	require.NotContains(t, logged, "hunter2")
+	require.NotContains(t, logged, "s3cret")
+	require.Contains(t, logged, redactedValue)
+}
+
+func TestBodyLoggingRedact(t *testing.T) {
+	c := &bodyLoggingConfig{redactKeys: map[string]struct{}{"secret": {}}}
+	tests := []struct {
+		name    string
+		body    string
+		partial bool
+		want    string
+		wantErr bool
+	}{
+		{name: "nested key", body: `{"a":[1,{"Secret":"x"}],"b":true}`, want: `{"a":[1,{"Secret":"[REDACTED]"}],"b":true}`},
+		{name: "container value", body: `{"secret":{"k":[1,2]},"n":1.50}`, want: `{"secret":"[REDACTED]","n":1.50}`},
+		{name: "partial body", body: `{"a":"b","secret":"hun`, partial: true, want: `{"a":"b","secret"`},
+		{name: "not json", body: `{"a":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.redact([]byte(tt.body), tt.partial)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestTracingMiddlewareSampleRateHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		base        sdktrace.Sampler
+		enabled     bool
+		header      string
+		wantSampled bool
+	}{
+		{name: "1.0 forces sampling", base: sdktrace.NeverSample(), enabled: true, header: "1.0", wantSampled: true},
+		{name: "0.0 drops", base: sdktrace.AlwaysSample(), enabled: true, header: "0.0", wantSampled: false},
+		{name: "invalid value ignored", base: sdktrace.AlwaysSample(), enabled: true, header: "2", wantSampled: true},
+		{name: "disabled ignores header", base: sdktrace.NeverSample(), enabled: false, header: "1.0", wantSampled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t, sdktrace.WithSampler(NewFilterSampler(tt.base)))
+			handler := TracingMiddlewareWithOptions(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				WithSampleRateHeader("", tt.enabled),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(SampleRateHeader, tt.header)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantSampled {
+				require.Len(t, recorder.Ended(), 1)
+				require.True(t, recorder.Ended()[0].SpanContext().IsSampled())
+			} else {
+				require.Empty(t, recorder.Ended())
+			}
+		})
+	}
+}
+
+func TestTracingMiddlewareSpanID(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	var buf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &buf)
+
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		WithAccessLog(AccessLogConfig{IncludeSpanID: true}),
+		WithTraceResponseHeaders(true),
+	)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	require.Len(t, recorder.Ended(), 1)
+	sc := recorder.Ended()[0].SpanContext()
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	require.Equal(t, "http request", entries[0]["message"])
+	require.Equal(t, float64(http.StatusTeapot), entries[0]["status"])
+	require.Equal(t, sc.TraceID().String(), entries[0]["trace_id"])
+	require.Equal(t, sc.SpanID().String(), entries[0]["span_id"])
+
+	require.Equal(t, sc.TraceID().String(), rec.Header().Get(TraceIDHeader))
+	require.Equal(t, sc.SpanID().String(), rec.Header().Get(SpanIDHeader))
+}
+
+func TestTracingMiddlewareAccessLogTraceFlags(t *testing.T) {
+	setTestTracerProvider(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	tests := []struct {
+		name        string
+		traceparent string
+		wantSampled bool
+	}{
+		{name: "sampled parent", traceparent: "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01", wantSampled: true},
+		{name: "unsampled parent", traceparent: "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-00", wantSampled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			SetupLoggingWithWriter("info", "json", &buf)
+			handler := TracingMiddlewareWithOptions(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				WithAccessLog(AccessLogConfig{IncludeSampled: true, IncludeTraceState: true}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.Header.Set("traceparent", tt.traceparent)
+			req.Header.Set("tracestate", "vendor=value")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := logEntries(t, &buf)
+			require.Len(t, entries, 1)
+			require.Equal(t, tt.wantSampled, entries[0]["sampled"])
+			require.Equal(t, "vendor=value", entries[0]["tracestate"])
+		})
+	}
+}
+
+func TestTracingMiddlewareMaxSpanNames(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithMaxSpanNames(3),
+	)
+
+	for i := range 10 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/items/%d", i), nil))
+	}
+	// Names seen before the cap was reached are kept
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+
+	names := map[string]int{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()]++
+	}
+	require.Equal(t, map[string]int{
+		"GET /items/0":   1,
+		"GET /items/1":   2,
+		"GET /items/2":   1,
+		OverflowSpanName: 7,
+	}, names)
+}
+
+func TestTracingMiddlewareSpanNameBodyLimit(t *testing.T) {
+	const small = `{"method":"eth_call"}`
+	large := `{"method":"eth_sendRawTransaction","params":["` + strings.Repeat("ab", 100) + `"]}`
+	tests := []struct {
+		name          string
+		body          string
+		contentType   string
+		unknownLength bool
+		want          string
+	}{
+		{name: "small JSON", body: small, contentType: "application/json", want: "eth_call"},
+		{name: "JSON with parameters", body: small, contentType: "application/json; charset=utf-8", want: "eth_call"},
+		{name: "non-JSON content type", body: small, contentType: "text/plain", want: "POST /rpc"},
+		{name: "missing content type", body: small, want: "POST /rpc"},
+		{name: "declared length over limit", body: large, contentType: "application/json", want: "POST /rpc"},
+		{name: "unknown length over limit", body: large, contentType: "application/json", unknownLength: true, want: "POST /rpc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			var received string
+			handler := TracingMiddlewareWithOptions(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, err := io.ReadAll(r.Body)
+					require.NoError(t, err)
+					received = string(b)
+				}),
+				WithSpanNameBodyLimit(64),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Equal(t, tt.body, received, "handler must receive the full body")
+			require.Len(t, recorder.Ended(), 1)
+			require.Equal(t, tt.want, recorder.Ended()[0].Name())
+		})
+	}
+}
+
+func TestTracingMiddlewareIgnoredPaths(t *testing.T) {
+	paths := []string{"/health", "/healthz", "/readyz", "/debug/pprof/heap", "/items"}
+	tests := []struct {
+		name   string
+		opts   []MiddlewareOption
+		traced []string
+	}{
+		{name: "default", traced: []string{"/healthz", "/readyz", "/debug/pprof/heap", "/items"}},
+		{
+			name:   "exact paths replace the default",
+			opts:   []MiddlewareOption{WithIgnoredPaths("/healthz", "/readyz")},
+			traced: []string{"/health", "/debug/pprof/heap", "/items"},
+		},
+		{
+			name:   "prefix pattern",
+			opts:   []MiddlewareOption{WithIgnoredPaths("/health"), WithIgnoredPaths("/debug/*")},
+			traced: []string{"/healthz", "/readyz", "/items"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			handler := TracingMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tt.opts...)
+			for _, path := range paths {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+			}
+
+			var traced []string
+			for _, span := range recorder.Ended() {
+				traced = append(traced, strings.TrimPrefix(span.Name(), "GET "))
+			}
+			require.Equal(t, tt.traced, traced)
+		})
+	}
+}
+
+func TestTracingMiddlewareResponseAttributes(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			w.WriteHeader(http.StatusAccepted)
+			_, ok := w.(http.Flusher)
+			require.True(t, ok, "the writer must still be a Flusher")
+			w.(http.Flusher).Flush()
+		case "/fail":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/upgrade":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+			_ = conn.Close()
+		}
+	}))
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	for _, path := range []string{"/stream", "/fail", "/upgrade"} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	status := func(i int) int64 {
+		for _, attr := range spans[i].Attributes() {
+			if attr.Key == "http.response.status_code" {
+				return attr.Value.AsInt64()
+			}
+		}
+		return 0
+	}
+	hasDuration := func(i int) bool {
+		for _, attr := range spans[i].Attributes() {
+			if attr.Key == "http.server.duration_ms" {
+				return attr.Value.AsFloat64() >= 0
+			}
+		}
+		return false
+	}
+
+	// The status code and the error status come from otelhttp.
+	require.EqualValues(t, http.StatusAccepted, status(0))
+	require.True(t, hasDuration(0))
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	require.EqualValues(t, http.StatusServiceUnavailable, status(1))
+	require.True(t, hasDuration(1))
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+
+	// otelhttp reports a hijacked connection with the default 200 status
+	require.EqualValues(t, http.StatusOK, status(2))
+	require.True(t, hasDuration(2))
+	require.Equal(t, codes.Unset, spans[2].Status().Code)
+}
+
+func TestTracingMiddlewareHeaderCounts(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Add("Set-Cookie", "a=1")
+			w.Header().Add("Set-Cookie", "b=2")
+		}),
+		WithHeaderCountAttributes(),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Add("X-Forwarded-For", "10.0.0.1")
+	req.Header.Add("X-Forwarded-For", "10.0.0.2")
+	req.Header.Set("User-Agent", "test")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, recorder.Ended(), 1)
+	attrs := recorder.Ended()[0].Attributes()
+	require.Contains(t, attrs, attribute.Int("http.request.header_count", 4))
+	require.Contains(t, attrs, attribute.Int("http.response.header_count", 3))
+}
+
+func TestTracingMiddlewareDebugMetricAttribute(t *testing.T) {
+	setTestTracerProvider(t, sdktrace.WithSampler(NewFilterSampler(sdktrace.NeverSample())))
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithSampleRateHeader("", true),
+		WithDebugMetricAttribute(),
+	)
+	forced := httptest.NewRequest(http.MethodGet, "/", nil)
+	forced.Header.Set(SampleRateHeader, "1")
+	handler.ServeHTTP(httptest.NewRecorder(), forced)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	counts := map[bool]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http.server.request.duration" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				debug, ok := dp.Attributes.Value("debug")
+				require.True(t, ok)
+				counts[debug.AsBool()] += dp.Count
+			}
+		}
+	}
+	require.Equal(t, map[bool]uint64{true: 1, false: 2}, counts)
+}
+
+func TestTracingMiddlewareSLOMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	handler := TracingMiddlewareWithOptions(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				time.Sleep(20 * time.Millisecond)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		WithSLOMetrics(SLOConfig{LatencyThreshold: 10 * time.Millisecond}),
+	)
+
+	collect := func() map[string]int64 {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		counts := map[string]int64{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "requests.good" || m.Name == "requests.total" {
+					counts[m.Name] = m.Data.(metricdata.Sum[int64]).DataPoints[0].Value
+				}
+			}
+		}
+		return counts
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	require.Equal(t, map[string]int64{"requests.good": 1, "requests.total": 1}, collect())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	require.Equal(t, map[string]int64{"requests.good": 1, "requests.total": 2}, collect())
+}
+
+func TestTracingMiddlewareMetricCardinalityLimit(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	mux := http.NewServeMux()
+	for i := range 20 {
+		mux.HandleFunc(fmt.Sprintf("/route%d", i), func(w http.ResponseWriter, r *http.Request) {})
+	}
+	handler := TracingMiddlewareWithOptions(mux,
+		WithSLOMetrics(SLOConfig{LatencyThreshold: time.Minute}),
+		WithMetricCardinalityLimit(5),
+	)
+	for i := range 20 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/route%d", i), nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/route0", nil))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	var checked int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "requests.good" && m.Name != "requests.total" {
+				continue
+			}
+			checked++
+			counts := map[string]int64{}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				route, ok := dp.Attributes.Value("http.route")
+				require.True(t, ok)
+				counts[route.AsString()] = dp.Value
+			}
+			require.Len(t, counts, 6, m.Name)
+			require.Equal(t, int64(2), counts["/route0"], m.Name)
+			require.Equal(t, int64(15), counts[OverflowValue], m.Name)
+		}
+	}
+	require.Equal(t, 2, checked)
+}
+
+func listItems(w http.ResponseWriter, r *http.Request) {}
+
+type itemsHandler struct{}
+
+func (itemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func TestTracingMiddlewareHandlerName(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", listItems)
+	mux.Handle("/items/", itemsHandler{})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		want    string
+	}{
+		{name: "handler func", handler: http.HandlerFunc(listItems), path: "/", want: "github.com/polymerdao/telemetry.listItems"},
+		{name: "mux matched func", handler: mux, path: "/items", want: "github.com/polymerdao/telemetry.listItems"},
+		{name: "mux matched type", handler: mux, path: "/items/1", want: "telemetry.itemsHandler"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			handler := TracingMiddlewareWithOptions(tt.handler, WithHandlerNameAttribute())
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Len(t, recorder.Ended(), 1)
+			require.Contains(t, recorder.Ended()[0].Attributes(), attribute.String("http.handler", tt.want))
+		})
+	}
+}
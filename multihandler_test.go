@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMultiHandler(t *testing.T) {
+	var jsonBuf, textBuf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &jsonBuf, WithHandlers(slog.NewTextHandler(&textBuf, nil)))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x02},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	slog.With("component", "api").InfoContext(ctx, "test message")
+	slog.Debug("below both levels")
+
+	var logEntry map[string]any
+	require.NoError(t, json.Unmarshal(jsonBuf.Bytes(), &logEntry))
+	require.Equal(t, "test message", logEntry["message"])
+	require.Equal(t, "api", logEntry["component"])
+	require.Equal(t, sc.TraceID().String(), logEntry["logging.googleapis.com/trace"])
+
+	text := textBuf.String()
+	require.Contains(t, text, "msg=\"test message\"")
+	require.Contains(t, text, "component=api")
+	require.Contains(t, text, "logging.googleapis.com/trace="+sc.TraceID().String())
+	require.NotContains(t, text, "below both levels")
+}
+
+func TestMultiHandlerOwnLevels(t *testing.T) {
+	var jsonBuf, debugBuf bytes.Buffer
+	SetupLoggingWithWriter("info", "json", &jsonBuf,
+		WithHandlers(slog.NewTextHandler(&debugBuf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	slog.Debug("debug details")
+	require.Empty(t, jsonBuf.String(), "below the main level")
+	require.Contains(t, debugBuf.String(), "debug details")
+}
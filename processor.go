@@ -0,0 +1,493 @@
+package telemetry
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewErrorSpanProcessor returns a span processor that only passes spans with an
+// error status to next. Registered next to the regular processor, it mirrors
+// error spans to a secondary backend while every span still reaches the primary.
+func NewErrorSpanProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &errorSpanProcessor{
+		processor: next,
+	}
+}
+
+type errorSpanProcessor struct {
+	processor sdktrace.SpanProcessor
+}
+
+func (e *errorSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	e.processor.OnStart(ctx, s)
+}
+
+func (e *errorSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.Status().Code == codes.Error {
+		e.processor.OnEnd(s)
+	}
+}
+
+func (e *errorSpanProcessor) Shutdown(ctx context.Context) error {
+	return e.processor.Shutdown(ctx)
+}
+
+func (e *errorSpanProcessor) ForceFlush(ctx context.Context) error {
+	return e.processor.ForceFlush(ctx)
+}
+
+// VerbosityKey is the span attribute read by NewVerbositySpanProcessor. Higher
+// values mark more detailed spans, like log levels in reverse: 0 is always
+// relevant, larger numbers are only useful when debugging.
+const VerbosityKey = attribute.Key("verbosity")
+
+// NewVerbositySpanProcessor returns a span processor that drops spans whose
+// VerbosityKey attribute exceeds maxVerbosity and passes every other span to
+// next. Spans without the attribute, or marked with KeepSpanAttribute, are kept.
+func NewVerbositySpanProcessor(maxVerbosity int64, next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &verbositySpanProcessor{
+		processor:    next,
+		maxVerbosity: maxVerbosity,
+	}
+}
+
+type verbositySpanProcessor struct {
+	processor    sdktrace.SpanProcessor
+	maxVerbosity int64
+}
+
+func (v *verbositySpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	v.processor.OnStart(ctx, s)
+}
+
+func (v *verbositySpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	var verbose, keep bool
+	for _, attr := range s.Attributes() {
+		switch attr.Key {
+		case VerbosityKey:
+			verbose = attr.Value.AsInt64() > v.maxVerbosity
+		case KeepSpanAttribute.Key:
+			keep = attr.Value.AsBool()
+		}
+	}
+	if verbose && !keep {
+		return
+	}
+	v.processor.OnEnd(s)
+}
+
+func (v *verbositySpanProcessor) Shutdown(ctx context.Context) error {
+	return v.processor.Shutdown(ctx)
+}
+
+func (v *verbositySpanProcessor) ForceFlush(ctx context.Context) error {
+	return v.processor.ForceFlush(ctx)
+}
+
+// NewNameRatioProcessor returns a span processor that passes only a fraction of
+// the spans with selected names to next, such as 10% of "cache.get" spans, and
+// every other span. ratios maps a span name to the fraction to keep, in [0, 1]. A
+// name ending with "*" matches as a prefix; exact names take precedence, then the
+// longest prefix. The choice is made from a hash of the trace ID and the matching
+// name, so the spans of one name are kept or dropped together within a trace,
+// independently of a trace ID ratio sampler in front of the processor. Spans marked with
+// KeepSpanAttribute are always kept. The choice is made once, when the span
+// starts, from its name and attributes at that time; a dropped span reaches
+// neither OnStart nor OnEnd of next.
+func NewNameRatioProcessor(ratios map[string]float64, next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	p := &nameRatioProcessor{
+		processor: next,
+		exact:     make(map[string]uint64, len(ratios)),
+	}
+	for name, ratio := range ratios {
+		bound := ratioBound(ratio)
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			p.prefixes = append(p.prefixes, namePrefixBound{prefix: prefix, bound: bound})
+		} else {
+			p.exact[name] = bound
+		}
+	}
+	slices.SortFunc(p.prefixes, func(a, b namePrefixBound) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+	return p
+}
+
+type nameRatioProcessor struct {
+	processor sdktrace.SpanProcessor
+	exact     map[string]uint64
+	// prefixes are sorted from the longest prefix.
+	prefixes []namePrefixBound
+	// dropped holds the in-flight spans that are not forwarded to processor.
+	dropped sync.Map
+}
+
+type namePrefixBound struct {
+	prefix string
+	bound  uint64
+}
+
+// ratioBound converts a ratio into the bound under which a 63-bit hash is kept,
+// as the SDK's trace ID ratio sampler does with the trace ID.
+func ratioBound(ratio float64) uint64 {
+	return uint64(min(max(ratio, 0), 1) * (1 << 63))
+}
+
+func (p *nameRatioProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if !p.keep(s) {
+		p.dropped.Store(keyOf(s.SpanContext()), struct{}{})
+		return
+	}
+	p.processor.OnStart(ctx, s)
+}
+
+func (p *nameRatioProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if _, ok := p.dropped.LoadAndDelete(keyOf(s.SpanContext())); ok {
+		return
+	}
+	p.processor.OnEnd(s)
+}
+
+func (p *nameRatioProcessor) keep(s sdktrace.ReadOnlySpan) bool {
+	bound, rule, ok := p.boundFor(s.Name())
+	if !ok || slices.Contains(s.Attributes(), KeepSpanAttribute) {
+		return true
+	}
+	return traceHash(s.SpanContext().TraceID(), rule)>>1 < bound
+}
+
+// boundFor returns the bound of the rule matching name, and the rule itself.
+func (p *nameRatioProcessor) boundFor(name string) (uint64, string, bool) {
+	if bound, ok := p.exact[name]; ok {
+		return bound, name, true
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(name, prefix.prefix) {
+			return prefix.bound, prefix.prefix + "*", true
+		}
+	}
+	return 0, "", false
+}
+
+// traceHash hashes traceID salted with rule. The SDK's ratio sampler reads the
+// trace ID bits directly, so using them here as well would keep every span of a
+// name whose ratio is at least the sampler's.
+func traceHash(traceID trace.TraceID, rule string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(rule))
+	h.Write(traceID[:])
+	return h.Sum64()
+}
+
+func (p *nameRatioProcessor) Shutdown(ctx context.Context) error {
+	return p.processor.Shutdown(ctx)
+}
+
+func (p *nameRatioProcessor) ForceFlush(ctx context.Context) error {
+	return p.processor.ForceFlush(ctx)
+}
+
+// transactionIDProcessor stamps spans with the transaction ID found in the
+// context they are started from.
+type transactionIDProcessor struct{}
+
+func (transactionIDProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if id, ok := TransactionIDFromContext(ctx); ok {
+		s.SetAttributes(TransactionIDKey.String(id))
+	}
+}
+
+func (transactionIDProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (transactionIDProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (transactionIDProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// NewBaggageSpanProcessor returns a span processor that copies the baggage members
+// named by keys, such as a tenant or request ID, from the context a span is
+// started from onto the span as attributes of the same name. Without keys, every
+// member is copied. Members missing from the baggage are skipped.
+func NewBaggageSpanProcessor(keys ...string) sdktrace.SpanProcessor {
+	return &baggageSpanProcessor{keys: keys}
+}
+
+type baggageSpanProcessor struct {
+	keys []string
+}
+
+func (p *baggageSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return
+	}
+	if len(p.keys) == 0 {
+		for _, member := range bag.Members() {
+			s.SetAttributes(attribute.String(member.Key(), member.Value()))
+		}
+		return
+	}
+	for _, key := range p.keys {
+		if member := bag.Member(key); member.Key() != "" {
+			s.SetAttributes(attribute.String(key, member.Value()))
+		}
+	}
+}
+
+func (*baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (*baggageSpanProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (*baggageSpanProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// SlowSpanAttribute marks spans that ran longer than the threshold of
+// NewSlowSpanProcessor.
+var SlowSpanAttribute = attribute.Bool("slow", true)
+
+// NewSlowSpanProcessor returns a span processor that adds SlowSpanAttribute to
+// spans running longer than threshold before passing them to next, so slow
+// operations can be searched for in the backend. At most 65536 spans are measured
+// at a time; spans started beyond that, for example because earlier spans were
+// never ended, are passed unchanged.
+func NewSlowSpanProcessor(threshold time.Duration, next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &slowSpanProcessor{
+		processor: next,
+		threshold: threshold,
+		clock:     wallClock{},
+		started:   newSpanStartTimes(),
+	}
+}
+
+type slowSpanProcessor struct {
+	processor sdktrace.SpanProcessor
+	threshold time.Duration
+	clock     clock
+	// started holds the start time of in-flight spans, measured with clock.
+	started *spanStartTimes
+}
+
+// spanKey identifies a span across OnStart and OnEnd.
+type spanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+func keyOf(sc trace.SpanContext) spanKey {
+	return spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+}
+
+func (p *slowSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.started.store(keyOf(s.SpanContext()), p.clock.Now())
+	p.processor.OnStart(ctx, s)
+}
+
+func (p *slowSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if start, ok := p.started.take(keyOf(s.SpanContext())); ok {
+		if p.clock.Now().Sub(start) > p.threshold {
+			s = &annotatedSpan{ReadOnlySpan: s, extra: []attribute.KeyValue{SlowSpanAttribute}}
+		}
+	}
+	p.processor.OnEnd(s)
+}
+
+func (p *slowSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.processor.Shutdown(ctx)
+}
+
+func (p *slowSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.processor.ForceFlush(ctx)
+}
+
+// annotatedSpan adds attributes to an ended span, which can no longer be modified.
+type annotatedSpan struct {
+	sdktrace.ReadOnlySpan
+	extra []attribute.KeyValue
+}
+
+func (s *annotatedSpan) Attributes() []attribute.KeyValue {
+	return slices.Concat(s.ReadOnlySpan.Attributes(), s.extra)
+}
+
+// maxInFlightSpans bounds the start times held by a processor that measures spans,
+// so spans that are never ended cannot grow it without limit.
+const maxInFlightSpans = 1 << 16
+
+// spanStartTimes holds the start time of in-flight spans, up to limit of them.
+// Spans started past the limit are not measured. An entry is only removed when
+// its span ends, so spans that are never ended keep their place.
+type spanStartTimes struct {
+	limit int64
+	count atomic.Int64
+	times sync.Map
+}
+
+func newSpanStartTimes() *spanStartTimes {
+	return &spanStartTimes{limit: maxInFlightSpans}
+}
+
+func (t *spanStartTimes) store(key spanKey, start time.Time) {
+	if t.count.Add(1) > t.limit {
+		t.count.Add(-1)
+		return
+	}
+	t.times.Store(key, start)
+}
+
+// take returns and removes the start time of the span with key, if it is held.
+func (t *spanStartTimes) take(key spanKey) (time.Time, bool) {
+	start, ok := t.times.LoadAndDelete(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	t.count.Add(-1)
+	return start.(time.Time), true
+}
+
+// ClockSkewKey is the span attribute set by NewMonotonicSpanProcessor on spans
+// whose wall-clock duration diverged from the monotonic one. Its value is the
+// wall-clock duration minus the monotonic duration, in milliseconds.
+const ClockSkewKey = attribute.Key("clock.skew_ms")
+
+// NewMonotonicSpanProcessor returns a span processor that measures each span with
+// the monotonic clock before passing it to next. When the duration given by the
+// span's start and end timestamps differs from it by more than maxDivergence, as
+// after a wall-clock adjustment or with explicit timestamps from a skewed clock,
+// the span is passed with its end time moved to start plus the monotonic duration
+// and with the ClockSkewKey attribute. At most 65536 spans are measured at a
+// time; spans started beyond that, for example because earlier spans were never
+// ended, are passed unchanged.
+func NewMonotonicSpanProcessor(maxDivergence time.Duration, next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &monotonicSpanProcessor{
+		processor:     next,
+		maxDivergence: maxDivergence,
+		clock:         wallClock{},
+		started:       newSpanStartTimes(),
+	}
+}
+
+type monotonicSpanProcessor struct {
+	processor     sdktrace.SpanProcessor
+	maxDivergence time.Duration
+	// clock readings from time.Now carry the monotonic clock, which Sub uses.
+	clock clock
+	// started holds the start time of in-flight spans, measured with clock.
+	started *spanStartTimes
+}
+
+func (p *monotonicSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.started.store(keyOf(s.SpanContext()), p.clock.Now())
+	p.processor.OnStart(ctx, s)
+}
+
+func (p *monotonicSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if start, ok := p.started.take(keyOf(s.SpanContext())); ok {
+		monotonic := p.clock.Now().Sub(start)
+		skew := s.EndTime().Sub(s.StartTime()) - monotonic
+		if skew > p.maxDivergence || -skew > p.maxDivergence {
+			s = &annotatedSpan{
+				ReadOnlySpan: &correctedSpan{ReadOnlySpan: s, end: s.StartTime().Add(monotonic)},
+				extra:        []attribute.KeyValue{ClockSkewKey.Int64(skew.Milliseconds())},
+			}
+		}
+	}
+	p.processor.OnEnd(s)
+}
+
+func (p *monotonicSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.processor.Shutdown(ctx)
+}
+
+func (p *monotonicSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.processor.ForceFlush(ctx)
+}
+
+// correctedSpan reports a different end time for an ended span.
+type correctedSpan struct {
+	sdktrace.ReadOnlySpan
+	end time.Time
+}
+
+func (s *correctedSpan) EndTime() time.Time {
+	return s.end
+}
+
+// NewResourceOverrideProcessor returns a span processor that passes spans to next
+// with attrs merged over their resource. When spans fan out to several backends,
+// it lets one of them see, for example, a different service.name, while the other
+// backends keep the original resource.
+func NewResourceOverrideProcessor(next sdktrace.SpanProcessor, attrs ...attribute.KeyValue) sdktrace.SpanProcessor {
+	return &resourceOverrideProcessor{
+		processor: next,
+		override:  resource.NewSchemaless(attrs...),
+		merged:    make(map[*resource.Resource]*resource.Resource),
+	}
+}
+
+type resourceOverrideProcessor struct {
+	processor sdktrace.SpanProcessor
+	override  *resource.Resource
+
+	// merged caches the overridden resource, as spans of a provider share one.
+	mu     sync.Mutex
+	merged map[*resource.Resource]*resource.Resource
+}
+
+func (p *resourceOverrideProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.processor.OnStart(ctx, s)
+}
+
+func (p *resourceOverrideProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.processor.OnEnd(&resourceOverrideSpan{ReadOnlySpan: s, resource: p.resourceFor(s.Resource())})
+}
+
+func (p *resourceOverrideProcessor) resourceFor(res *resource.Resource) *resource.Resource {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if merged, ok := p.merged[res]; ok {
+		return merged
+	}
+	merged, err := resource.Merge(res, p.override)
+	if err != nil {
+		// Only conflicting schema URLs fail, and the override has none.
+		merged = res
+	}
+	p.merged[res] = merged
+	return merged
+}
+
+func (p *resourceOverrideProcessor) Shutdown(ctx context.Context) error {
+	return p.processor.Shutdown(ctx)
+}
+
+func (p *resourceOverrideProcessor) ForceFlush(ctx context.Context) error {
+	return p.processor.ForceFlush(ctx)
+}
+
+// resourceOverrideSpan reports a different resource for an ended span.
+type resourceOverrideSpan struct {
+	sdktrace.ReadOnlySpan
+	resource *resource.Resource
+}
+
+func (s *resourceOverrideSpan) Resource() *resource.Resource {
+	return s.resource
+}
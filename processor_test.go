@@ -0,0 +1,327 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestErrorSpanProcessor(t *testing.T) {
+	primary, secondary := tracetest.NewInMemoryExporter(), tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(primary)),
+		sdktrace.WithSpanProcessor(NewErrorSpanProcessor(sdktrace.NewSimpleSpanProcessor(secondary))),
+	)
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	ok.End()
+	_, failed := tracer.Start(context.Background(), "failed")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+
+	require.Len(t, primary.GetSpans(), 2)
+	require.Len(t, secondary.GetSpans(), 1)
+	require.Equal(t, "failed", secondary.GetSpans()[0].Name)
+}
+
+func TestVerbositySpanProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(NewVerbositySpanProcessor(1, sdktrace.NewSimpleSpanProcessor(exporter))),
+	)
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	for _, span := range []struct {
+		name  string
+		attrs []attribute.KeyValue
+	}{
+		{name: "info", attrs: []attribute.KeyValue{VerbosityKey.Int(1)}},
+		{name: "debug", attrs: []attribute.KeyValue{VerbosityKey.Int(2)}},
+		{name: "unset"},
+		{name: "debug kept", attrs: []attribute.KeyValue{VerbosityKey.Int(2), KeepSpanAttribute}},
+	} {
+		_, s := tracer.Start(context.Background(), span.name, trace.WithAttributes(span.attrs...))
+		s.End()
+	}
+
+	var names []string
+	for _, s := range exporter.GetSpans() {
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{"info", "unset", "debug kept"}, names)
+}
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestSlowSpanProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	processor := NewSlowSpanProcessor(100*time.Millisecond, sdktrace.NewSimpleSpanProcessor(exporter))
+	processor.(*slowSpanProcessor).clock = clock
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	_, fast := tracer.Start(context.Background(), "fast")
+	clock.Advance(100 * time.Millisecond)
+	fast.End()
+	_, slow := tracer.Start(context.Background(), "slow")
+	clock.Advance(101 * time.Millisecond)
+	slow.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.NotContains(t, spans[0].Attributes, SlowSpanAttribute)
+	require.Contains(t, spans[1].Attributes, SlowSpanAttribute)
+}
+
+func TestMonotonicSpanProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	processor := NewMonotonicSpanProcessor(time.Second, sdktrace.NewSimpleSpanProcessor(exporter))
+	processor.(*monotonicSpanProcessor).clock = clock
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	wall := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, steady := tracer.Start(context.Background(), "steady", trace.WithTimestamp(wall))
+	clock.Advance(100 * time.Millisecond)
+	steady.End(trace.WithTimestamp(wall.Add(150 * time.Millisecond)))
+
+	// The wall clock is set back 5s while the span runs for 100ms
+	_, jumped := tracer.Start(context.Background(), "jumped", trace.WithTimestamp(wall))
+	clock.Advance(100 * time.Millisecond)
+	jumped.End(trace.WithTimestamp(wall.Add(-4900 * time.Millisecond)))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, wall.Add(150*time.Millisecond), spans[0].EndTime)
+	for _, attr := range spans[0].Attributes {
+		require.NotEqual(t, ClockSkewKey, attr.Key)
+	}
+	require.Equal(t, wall.Add(100*time.Millisecond), spans[1].EndTime)
+	require.Contains(t, spans[1].Attributes, ClockSkewKey.Int64(-5000))
+}
+
+func TestSpanStartTimesLimit(t *testing.T) {
+	started := newSpanStartTimes()
+	started.limit = 2
+	start := time.Unix(0, 0)
+	for i := range byte(3) {
+		started.store(spanKey{spanID: trace.SpanID{i}}, start)
+	}
+
+	_, ok := started.take(spanKey{spanID: trace.SpanID{2}})
+	require.False(t, ok, "started past the limit")
+	got, ok := started.take(spanKey{spanID: trace.SpanID{0}})
+	require.True(t, ok)
+	require.Equal(t, start, got)
+
+	// Ending a span makes room for another
+	started.store(spanKey{spanID: trace.SpanID{3}}, start)
+	_, ok = started.take(spanKey{spanID: trace.SpanID{3}})
+	require.True(t, ok)
+	require.EqualValues(t, 1, started.count.Load())
+}
+
+func TestExportProcessorDroppedSpanState(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := newExportProcessor(sdktrace.NewSimpleSpanProcessor(exporter), time.Second)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+
+	_, dropped := tp.Tracer("test").Start(context.Background(), "dropped", trace.WithAttributes(DropSpanAttribute))
+	dropped.End()
+
+	require.Empty(t, exporter.GetSpans())
+	processor.(*monotonicSpanProcessor).started.times.Range(func(key, _ any) bool {
+		t.Errorf("span %v left in the started map", key)
+		return true
+	})
+}
+
+func TestResourceOverrideProcessor(t *testing.T) {
+	primary, legacy := tracetest.NewInMemoryExporter(), tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "checkout"),
+			attribute.String("region", "eu"),
+		)),
+		sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(primary)),
+		sdktrace.WithSpanProcessor(NewResourceOverrideProcessor(
+			sdktrace.NewSimpleSpanProcessor(legacy),
+			attribute.String("service.name", "legacy-checkout"),
+		)),
+	)
+	defer tp.Shutdown(context.Background())
+
+	for range 2 {
+		_, span := tp.Tracer("test").Start(context.Background(), "op")
+		span.End()
+	}
+
+	serviceName := func(s tracetest.SpanStub) string {
+		name, _ := s.Resource.Set().Value("service.name")
+		return name.AsString()
+	}
+	require.Len(t, primary.GetSpans(), 2)
+	require.Len(t, legacy.GetSpans(), 2)
+	for i := range 2 {
+		require.Equal(t, "checkout", serviceName(primary.GetSpans()[i]))
+		require.Equal(t, "legacy-checkout", serviceName(legacy.GetSpans()[i]))
+		region, _ := legacy.GetSpans()[i].Resource.Set().Value("region")
+		require.Equal(t, "eu", region.AsString(), "other attributes are kept")
+	}
+}
+
+func TestNameRatioProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	slow := NewSlowSpanProcessor(time.Hour, sdktrace.NewSimpleSpanProcessor(exporter))
+	processor := NewNameRatioProcessor(
+		map[string]float64{"cache.get": 0.1, "cache.*": 0.5, "db.*": 0},
+		slow,
+	)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	const n = 2000
+	for range n {
+		for _, name := range []string{"cache.get", "cache.set", "db.query", "request"} {
+			_, span := tracer.Start(context.Background(), name)
+			span.End()
+		}
+	}
+	_, kept := tracer.Start(context.Background(), "db.query", trace.WithAttributes(KeepSpanAttribute))
+	kept.End()
+
+	counts := map[string]int{}
+	for _, span := range exporter.GetSpans() {
+		counts[span.Name]++
+	}
+	require.InDelta(t, 0.1*n, counts["cache.get"], 0.03*n)
+	require.InDelta(t, 0.5*n, counts["cache.set"], 0.05*n, "prefix ratio")
+	require.Equal(t, 1, counts["db.query"], "only the span marked keep")
+	require.Equal(t, n, counts["request"], "other names pass fully")
+
+	t.Run("whole traces", func(t *testing.T) {
+		exporter.Reset()
+		const children = 5
+		for range 100 {
+			ctx, root := tracer.Start(context.Background(), "request")
+			for range children {
+				_, child := tracer.Start(ctx, "cache.set")
+				child.End()
+			}
+			root.End()
+		}
+
+		perTrace := map[trace.TraceID]int{}
+		for _, span := range exporter.GetSpans() {
+			if span.Name == "cache.set" {
+				perTrace[span.SpanContext.TraceID()]++
+			}
+		}
+		require.NotEmpty(t, perTrace)
+		for traceID, count := range perTrace {
+			require.Equal(t, children, count, "trace %s is split", traceID)
+		}
+	})
+
+	t.Run("behind a ratio sampler", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.TraceIDRatioBased(0.5)),
+			sdktrace.WithSpanProcessor(NewNameRatioProcessor(
+				map[string]float64{"cache.get": 0.5},
+				sdktrace.NewSimpleSpanProcessor(exporter),
+			)),
+		)
+		defer tp.Shutdown(context.Background())
+
+		sampled := 0
+		for range n {
+			_, span := tp.Tracer("test").Start(context.Background(), "cache.get")
+			if span.SpanContext().IsSampled() {
+				sampled++
+			}
+			span.End()
+		}
+		require.InDelta(t, 0.5*float64(sampled), len(exporter.GetSpans()), 0.05*n)
+	})
+
+	t.Run("no state left", func(t *testing.T) {
+		for _, m := range []*sync.Map{&processor.(*nameRatioProcessor).dropped, &slow.(*slowSpanProcessor).started.times} {
+			m.Range(func(key, _ any) bool {
+				t.Errorf("span %v left in flight", key)
+				return true
+			})
+		}
+	})
+}
+
+func TestBaggageSpanProcessor(t *testing.T) {
+	ctx := SetBaggage(context.Background(), "tenant", "acme")
+	ctx = SetBaggage(ctx, "request.id", "req-1")
+
+	tests := []struct {
+		name string
+		keys []string
+		want []attribute.KeyValue
+	}{
+		{
+			name: "all members",
+			want: []attribute.KeyValue{attribute.String("request.id", "req-1"), attribute.String("tenant", "acme")},
+		},
+		{
+			name: "selected members",
+			keys: []string{"tenant", "missing"},
+			want: []attribute.KeyValue{attribute.String("tenant", "acme")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(NewBaggageSpanProcessor(tt.keys...)),
+				sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+			)
+			defer tp.Shutdown(context.Background())
+
+			_, span := tp.Tracer("test").Start(ctx, "op")
+			span.End()
+			_, plain := tp.Tracer("test").Start(context.Background(), "no-baggage")
+			plain.End()
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 2)
+			require.ElementsMatch(t, tt.want, spans[0].Attributes)
+			require.Empty(t, spans[1].Attributes)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// prometheusResourceLabels are the resource attributes added as labels to every
+// Prometheus series. The other resource attributes are only exposed in the
+// target_info metric, which keeps series cardinality low.
+var prometheusResourceLabels = []attribute.Key{
+	"service.name",
+	"service.namespace",
+	"service.version",
+	"deployment.environment",
+	"deployment.environment.name",
+}
+
+// InitPrometheusMeter initializes the global OpenTelemetry MeterProvider with the
+// same resource as InitTracer, for metrics scraped by Prometheus instead of
+// pushed. The returned handler serves the metrics in the Prometheus format and is
+// meant to be mounted on the service's mux, typically at /metrics:
+//
+//	handler, shutdown, err := telemetry.InitPrometheusMeter(ctx, "my-service")
+//	mux.Handle("/metrics", handler)
+//
+// The service name, namespace, version and deployment environment become labels
+// of every series. The metrics use a dedicated registry, so the handler does not
+// serve the default Prometheus registry.
+func InitPrometheusMeter(ctx context.Context, serviceName string) (http.Handler, func(context.Context) error, error) {
+	res, err := GetResource(ctx, serviceName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(
+		otelprometheus.WithRegisterer(registry),
+		otelprometheus.WithResourceAsConstantLabels(attribute.NewAllowKeysFilter(prometheusResourceLabels...)),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithResource(res), sdkmetric.WithReader(exporter))
+
+	// Set the global MeterProvider
+	otel.SetMeterProvider(mp)
+
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return handler, mp.Shutdown, nil
+}
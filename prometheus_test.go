@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestInitPrometheusMeter(t *testing.T) {
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=staging,host.arch=amd64")
+
+	handler, shutdown, err := InitPrometheusMeter(context.Background(), "test-service")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	counter, err := otel.Meter("test").Int64Counter("jobs")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `jobs_total{deployment_environment="staging",otel_scope_name="test",otel_scope_schema_url="",otel_scope_version="",service_name="test-service"} 3`)
+	require.Contains(t, string(body), `host_arch="amd64"`, "other resource attributes are in target_info")
+}
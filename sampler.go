@@ -0,0 +1,135 @@
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewSpanKindSampler returns a sampler that always samples server and consumer
+// spans, the entry points of a request, and delegates every other span to base.
+// This keeps the shape of each request while base (typically a ratio sampler)
+// reduces the volume of internal spans. It is not meant to be wrapped in
+// ParentBased, which would make children inherit the entry span's decision.
+func NewSpanKindSampler(base sdktrace.Sampler) sdktrace.Sampler {
+	return &spanKindSampler{base: base}
+}
+
+type spanKindSampler struct {
+	base sdktrace.Sampler
+}
+
+func (s *spanKindSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	switch p.Kind {
+	case trace.SpanKindServer, trace.SpanKindConsumer:
+		return sdktrace.AlwaysSample().ShouldSample(p)
+	default:
+		return s.base.ShouldSample(p)
+	}
+}
+
+func (s *spanKindSampler) Description() string {
+	return fmt.Sprintf("SpanKindSampler{%s}", s.base.Description())
+}
+
+// environmentKeys are the resource attributes naming the deployment environment,
+// in order of preference.
+var environmentKeys = []attribute.Key{"deployment.environment.name", "deployment.environment"}
+
+// NewEnvironmentSampler returns a trace ID ratio sampler whose ratio is picked
+// from ratios by the deployment environment of res, read once at creation. For
+// example {"dev": 1, "prod": 0.01} samples everything in dev and 1% in prod.
+// defaultRatio applies when the environment is missing or not in ratios.
+func NewEnvironmentSampler(res *resource.Resource, ratios map[string]float64, defaultRatio float64) sdktrace.Sampler {
+	ratio := defaultRatio
+	for _, key := range environmentKeys {
+		if env, ok := res.Set().Value(key); ok {
+			if r, found := ratios[env.AsString()]; found {
+				ratio = r
+			}
+			break
+		}
+	}
+	return sdktrace.TraceIDRatioBased(ratio)
+}
+
+// NewWarmupSampler returns a sampler that samples the first n traces started by
+// this process, then delegates to base. It makes the first requests after a
+// deploy visible regardless of the ratio. Only root spans, and spans with a remote
+// parent, count towards n; spans under a local parent are decided by base, which
+// should be ParentBased so they follow the warmup decision.
+func NewWarmupSampler(n int64, base sdktrace.Sampler) sdktrace.Sampler {
+	return &warmupSampler{base: base, remaining: n}
+}
+
+type warmupSampler struct {
+	base sdktrace.Sampler
+	// remaining is decremented by each counted trace until it drops below zero.
+	remaining int64
+}
+
+func (s *warmupSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if (!parent.IsValid() || parent.IsRemote()) && atomic.LoadInt64(&s.remaining) > 0 {
+		if atomic.AddInt64(&s.remaining, -1) >= 0 {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s *warmupSampler) Description() string {
+	return fmt.Sprintf("WarmupSampler{%s}", s.base.Description())
+}
+
+// samplerFromEnv returns the sampler chained by TELEMETRY_SAMPLERS (see
+// samplerChainFromEnv) or else the one selected by the standard
+// OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG variables. When unset it keeps
+// the historical default of sampling every trace, respecting the parent's
+// decision. Unknown samplers and invalid ratios log a warning and fall back to a
+// ratio of 1.0.
+func samplerFromEnv() sdktrace.Sampler {
+	if chain, ok := samplerChainFromEnv(os.Getenv(samplerChainEnv)); ok {
+		return chain
+	}
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER")))
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(samplerRatioFromEnv())
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "", "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(samplerRatioFromEnv()))
+	default:
+		slog.Warn("unsupported traces sampler, sampling every trace", "sampler", name)
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1.0))
+	}
+}
+
+// samplerRatioFromEnv reads the ratio in OTEL_TRACES_SAMPLER_ARG, defaulting to 1.0.
+func samplerRatioFromEnv() float64 {
+	value := strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER_ARG"))
+	if value == "" {
+		return 1.0
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		slog.Warn("invalid traces sampler ratio, sampling every trace", "ratio", value)
+		return 1.0
+	}
+	return ratio
+}
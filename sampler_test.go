@@ -0,0 +1,127 @@
+package telemetry
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// randomTraceIDs returns n trace IDs from a fixed seed so ratio tests are deterministic.
+func randomTraceIDs(n int) []trace.TraceID {
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]trace.TraceID, n)
+	for i := range ids {
+		rng.Read(ids[i][:])
+	}
+	return ids
+}
+
+func TestSpanKindSampler(t *testing.T) {
+	sampler := NewSpanKindSampler(sdktrace.TraceIDRatioBased(0.25))
+
+	const n = 1000
+	counts := map[trace.SpanKind]int{}
+	for _, id := range randomTraceIDs(n) {
+		for _, kind := range []trace.SpanKind{trace.SpanKindServer, trace.SpanKindConsumer, trace.SpanKindInternal} {
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: context.Background(),
+				TraceID:       id,
+				Name:          "span",
+				Kind:          kind,
+			})
+			if result.Decision == sdktrace.RecordAndSample {
+				counts[kind]++
+			}
+		}
+	}
+
+	require.Equal(t, n, counts[trace.SpanKindServer])
+	require.Equal(t, n, counts[trace.SpanKindConsumer])
+	require.InDelta(t, 0.25*n, counts[trace.SpanKindInternal], 0.05*n)
+}
+
+func TestEnvironmentSampler(t *testing.T) {
+	ratios := map[string]float64{"dev": 1, "prod": 0.01}
+	tests := []struct {
+		name  string
+		res   *resource.Resource
+		ratio float64
+	}{
+		{name: "dev", res: resource.NewSchemaless(attribute.String("deployment.environment", "dev")), ratio: 1},
+		{name: "prod", res: resource.NewSchemaless(attribute.String("deployment.environment.name", "prod")), ratio: 0.01},
+		{name: "unknown uses default", res: resource.NewSchemaless(attribute.String("deployment.environment", "qa")), ratio: 0.5},
+		{name: "missing uses default", res: resource.Empty(), ratio: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := NewEnvironmentSampler(tt.res, ratios, 0.5)
+
+			const n = 2000
+			sampled := 0
+			for _, id := range randomTraceIDs(n) {
+				result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: id})
+				if result.Decision == sdktrace.RecordAndSample {
+					sampled++
+				}
+			}
+			require.InDelta(t, tt.ratio*n, sampled, 0.03*n)
+		})
+	}
+}
+
+func TestWarmupSampler(t *testing.T) {
+	const warmup = 5
+	sampler := NewWarmupSampler(warmup, sdktrace.NeverSample())
+
+	var wg sync.WaitGroup
+	var sampled atomic.Int64
+	for _, id := range randomTraceIDs(warmup) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: id})
+			if result.Decision == sdktrace.RecordAndSample {
+				sampled.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, warmup, sampled.Load())
+
+	result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: trace.TraceID{0x01}})
+	require.Equal(t, sdktrace.Drop, result.Decision, "after warmup the base sampler decides")
+}
+
+func TestSamplerFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler string
+		arg     string
+		want    sdktrace.Sampler
+	}{
+		{name: "default", want: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1.0))},
+		{name: "traceidratio", sampler: "traceidratio", arg: "0.1", want: sdktrace.TraceIDRatioBased(0.1)},
+		{name: "parent based ratio", sampler: "parentbased_traceidratio", arg: "0.25", want: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.25))},
+		{name: "always off", sampler: "always_off", want: sdktrace.NeverSample()},
+		{name: "non-numeric arg", sampler: "traceidratio", arg: "abc", want: sdktrace.TraceIDRatioBased(1.0)},
+		{name: "arg out of range", sampler: "traceidratio", arg: "1.5", want: sdktrace.TraceIDRatioBased(1.0)},
+		{name: "unknown sampler", sampler: "jaeger_remote", want: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1.0))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+			t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+			require.Equal(t, tt.want.Description(), samplerFromEnv().Description())
+		})
+	}
+}
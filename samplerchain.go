@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// samplerChainEnv lists the stages of the sampler built by samplerChainFromEnv.
+const samplerChainEnv = "TELEMETRY_SAMPLERS"
+
+// samplerChainFromEnv builds a sampler from the ordered, comma-separated stages in
+// TELEMETRY_SAMPLERS, for example "ratelimit:100,ratio:0.1,force:priority=high".
+// A span starts out sampled and each stage, in order, may change the decision:
+//
+//   - ratelimit:N keeps at most N sampled spans per second and drops the rest.
+//   - ratio:R keeps a fraction R of the sampled spans, by trace ID.
+//   - force:key=value samples spans whose attribute key equals value, whatever
+//     the previous stages decided.
+//
+// The chain decides root spans and spans with a remote parent; other spans follow
+// their parent. Invalid stages log a warning and are skipped. It returns false
+// when the variable is unset or has no valid stage.
+func samplerChainFromEnv(value string) (sdktrace.Sampler, bool) {
+	var stages []chainStage
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		stage, err := parseChainStage(entry)
+		if err != nil {
+			slog.Warn("skipping invalid sampler stage", "env", samplerChainEnv, "stage", entry, "error", err)
+			continue
+		}
+		stages = append(stages, stage)
+	}
+	if len(stages) == 0 {
+		return nil, false
+	}
+	return sdktrace.ParentBased(&chainedSampler{stages: stages}), true
+}
+
+func parseChainStage(entry string) (chainStage, error) {
+	name, arg, _ := strings.Cut(entry, ":")
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "ratelimit":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("rate limit %q must be a positive number", arg)
+		}
+		return newRateLimitStage(limit, wallClock{}), nil
+	case "ratio":
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("ratio %q out of range [0, 1]", arg)
+		}
+		return &ratioStage{sampler: sdktrace.TraceIDRatioBased(ratio)}, nil
+	case "force":
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("force %q must be key=value", arg)
+		}
+		return &forceStage{rule: forceSampleRule{Attribute: key, Value: val}}, nil
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", name)
+	}
+}
+
+// chainStage is one step of a chainedSampler. It returns the decision after the
+// step, given the decision of the previous steps.
+type chainStage interface {
+	decide(p sdktrace.SamplingParameters, sampled bool) bool
+	String() string
+}
+
+type chainedSampler struct {
+	stages []chainStage
+}
+
+func (s *chainedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	sampled := true
+	var reason string
+	for _, stage := range s.stages {
+		next := stage.decide(p, sampled)
+		switch {
+		case sampled && !next:
+			reason = decisionDropped
+			if _, ok := stage.(*ratioStage); ok {
+				reason = decisionDroppedByRatio
+			}
+		case !sampled && next:
+			reason = decisionForced
+		}
+		sampled = next
+	}
+	if reason != "" {
+		setSamplingReason(p.ParentContext, reason)
+	}
+	decision := sdktrace.Drop
+	if sampled {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *chainedSampler) Description() string {
+	names := make([]string, len(s.stages))
+	for i, stage := range s.stages {
+		names[i] = stage.String()
+	}
+	return fmt.Sprintf("ChainedSampler{%s}", strings.Join(names, ","))
+}
+
+// rateLimitStage is a token bucket refilled at limit tokens per second, holding
+// at most limit tokens.
+type rateLimitStage struct {
+	limit float64
+	clock clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitStage(limit float64, clock clock) *rateLimitStage {
+	return &rateLimitStage{limit: limit, clock: clock, tokens: limit, last: clock.Now()}
+}
+
+func (s *rateLimitStage) decide(_ sdktrace.SamplingParameters, sampled bool) bool {
+	if !sampled {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	s.tokens = min(s.limit, s.tokens+now.Sub(s.last).Seconds()*s.limit)
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *rateLimitStage) String() string {
+	return fmt.Sprintf("ratelimit:%v", s.limit)
+}
+
+type ratioStage struct {
+	sampler sdktrace.Sampler
+}
+
+func (s *ratioStage) decide(p sdktrace.SamplingParameters, sampled bool) bool {
+	return sampled && s.sampler.ShouldSample(p).Decision == sdktrace.RecordAndSample
+}
+
+func (s *ratioStage) String() string {
+	return s.sampler.Description()
+}
+
+type forceStage struct {
+	rule forceSampleRule
+}
+
+func (s *forceStage) decide(p sdktrace.SamplingParameters, sampled bool) bool {
+	if sampled {
+		return true
+	}
+	for _, kv := range p.Attributes {
+		if kv.Key == attribute.Key(s.rule.Attribute) && kv.Value.Emit() == s.rule.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *forceStage) String() string {
+	return fmt.Sprintf("force:%s=%s", s.rule.Attribute, s.rule.Value)
+}
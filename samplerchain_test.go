@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSamplerChainFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "unset"},
+		{
+			name:  "full chain",
+			value: "ratelimit:100,ratio:0.1,force:priority=high",
+			want:  "ParentBased{root:ChainedSampler{ratelimit:100,TraceIDRatioBased{0.1},force:priority=high}",
+		},
+		{
+			name:  "invalid stages skipped",
+			value: "ratelimit:-1, ratio:2,force:priority,jaeger:1, ratio:0.5",
+			want:  "ParentBased{root:ChainedSampler{TraceIDRatioBased{0.5}}",
+		},
+		{name: "only invalid stages", value: "ratio:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler, ok := samplerChainFromEnv(tt.value)
+			if tt.want == "" {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Contains(t, sampler.Description(), tt.want)
+		})
+	}
+}
+
+func TestChainedSamplerBurst(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	sampler := &chainedSampler{stages: []chainStage{
+		newRateLimitStage(10, clock),
+		&ratioStage{sampler: sdktrace.TraceIDRatioBased(0.5)},
+		&forceStage{rule: forceSampleRule{Attribute: "priority", Value: "high"}},
+	}}
+
+	burst := func() (sampled, forced int) {
+		for i, id := range randomTraceIDs(1000) {
+			p := sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: id}
+			if i%100 == 0 {
+				p.Attributes = []attribute.KeyValue{attribute.String("priority", "high")}
+			}
+			if sampler.ShouldSample(p).Decision != sdktrace.RecordAndSample {
+				continue
+			}
+			if i%100 == 0 {
+				forced++
+			} else {
+				sampled++
+			}
+		}
+		return sampled, forced
+	}
+
+	sampled, forced := burst()
+	require.Equal(t, 10, forced, "forced spans are sampled past the rate limit")
+	require.Positive(t, sampled)
+	require.Less(t, sampled, 10, "the ratio applies to the spans let through by the rate limit")
+
+	sampled, forced = burst()
+	require.Equal(t, 10, forced)
+	require.Zero(t, sampled, "the bucket is empty until the clock moves")
+
+	clock.Advance(time.Second)
+	sampled, _ = burst()
+	require.Positive(t, sampled)
+}
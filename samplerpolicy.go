@@ -0,0 +1,233 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultTenantAttribute is the attribute or baggage key holding the tenant.
+const defaultTenantAttribute = "tenant.id"
+
+// samplerPolicy is the JSON document read by LoadSamplerFromFile:
+//
+//	{
+//	  "default_ratio": 0.1,
+//	  "routes": {"/orders": 0.5},
+//	  "tenant_attribute": "tenant.id",
+//	  "tenants": {"acme": 1.0},
+//	  "force_sample": [{"attribute": "priority", "value": "high"}]
+//	}
+type samplerPolicy struct {
+	DefaultRatio    *float64           `json:"default_ratio"`
+	Routes          map[string]float64 `json:"routes"`
+	TenantAttribute string             `json:"tenant_attribute"`
+	Tenants         map[string]float64 `json:"tenants"`
+	ForceSample     []forceSampleRule  `json:"force_sample"`
+}
+
+type forceSampleRule struct {
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
+}
+
+// LoadSamplerFromFile builds a sampler from the JSON policy at path. A span with
+// a valid parent, local or remote, follows the parent's sampled flag, so a trace
+// is never cut below its root. For each root span, the first matching rule
+// decides:
+//
+//  1. force_sample: sample if an attribute equals the given value.
+//  2. tenants: the ratio for the tenant, read from the tenant_attribute
+//     ("tenant.id" by default) span attribute or baggage member.
+//  3. routes: the ratio for the http.route, or url.path, span attribute.
+//  4. default_ratio, which defaults to 1.
+//
+// Use it with WithSampler.
+func LoadSamplerFromFile(path string) (sdktrace.Sampler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sampler policy: %w", err)
+	}
+	policy, err := parseSamplerPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sampler policy %s: %w", path, err)
+	}
+	return newPolicySampler(policy), nil
+}
+
+// WatchSamplerFile is like LoadSamplerFromFile but polls path every interval and
+// atomically swaps in the new policy when the file content changes. If the new
+// content is invalid, a warning is logged and the previous policy is kept.
+// Polling stops when ctx is done. The initial load must succeed.
+func WatchSamplerFile(ctx context.Context, path string, interval time.Duration) (sdktrace.Sampler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sampler policy: %w", err)
+	}
+	policy, err := parseSamplerPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sampler policy %s: %w", path, err)
+	}
+
+	s := &reloadingSampler{}
+	s.current.Store(newPolicySampler(policy))
+	go s.watch(ctx, path, interval, data)
+	return s, nil
+}
+
+type reloadingSampler struct {
+	current atomic.Pointer[policySampler]
+}
+
+func (s *reloadingSampler) watch(ctx context.Context, path string, interval time.Duration, last []byte) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("failed to read sampler policy, keeping the previous one", "path", path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		policy, err := parseSamplerPolicy(data)
+		if err != nil {
+			slog.Warn("invalid sampler policy, keeping the previous one", "path", path, "error", err)
+			continue
+		}
+		s.current.Store(newPolicySampler(policy))
+		slog.Info("reloaded sampler policy", "path", path)
+	}
+}
+
+func (s *reloadingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.current.Load().ShouldSample(p)
+}
+
+func (s *reloadingSampler) Description() string {
+	return fmt.Sprintf("ReloadingSampler{%s}", s.current.Load().Description())
+}
+
+func parseSamplerPolicy(data []byte) (*samplerPolicy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var policy samplerPolicy
+	if err := dec.Decode(&policy); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	checkRatio := func(field string, ratio float64) {
+		if ratio < 0 || ratio > 1 {
+			errs = append(errs, fmt.Errorf("%s: ratio %v out of range [0, 1]", field, ratio))
+		}
+	}
+	if policy.DefaultRatio != nil {
+		checkRatio("default_ratio", *policy.DefaultRatio)
+	}
+	for route, ratio := range policy.Routes {
+		checkRatio(fmt.Sprintf("routes[%q]", route), ratio)
+	}
+	for tenant, ratio := range policy.Tenants {
+		checkRatio(fmt.Sprintf("tenants[%q]", tenant), ratio)
+	}
+	for i, rule := range policy.ForceSample {
+		if rule.Attribute == "" {
+			errs = append(errs, fmt.Errorf("force_sample[%d]: attribute is required", i))
+		}
+	}
+	return &policy, errors.Join(errs...)
+}
+
+type policySampler struct {
+	defaultSampler  sdktrace.Sampler
+	routes          map[string]sdktrace.Sampler
+	tenantAttribute attribute.Key
+	tenants         map[string]sdktrace.Sampler
+	force           []forceSampleRule
+}
+
+func newPolicySampler(policy *samplerPolicy) *policySampler {
+	s := &policySampler{
+		defaultSampler:  sdktrace.AlwaysSample(),
+		routes:          make(map[string]sdktrace.Sampler, len(policy.Routes)),
+		tenantAttribute: attribute.Key(policy.TenantAttribute),
+		tenants:         make(map[string]sdktrace.Sampler, len(policy.Tenants)),
+		force:           policy.ForceSample,
+	}
+	if policy.DefaultRatio != nil {
+		s.defaultSampler = sdktrace.TraceIDRatioBased(*policy.DefaultRatio)
+	}
+	if s.tenantAttribute == "" {
+		s.tenantAttribute = defaultTenantAttribute
+	}
+	for route, ratio := range policy.Routes {
+		s.routes[route] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	for tenant, ratio := range policy.Tenants {
+		s.tenants[tenant] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	return s
+}
+
+func (s *policySampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if parent := trace.SpanContextFromContext(p.ParentContext); parent.IsValid() {
+		if parent.IsSampled() {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+		setSamplingReason(p.ParentContext, decisionDroppedByParent)
+		return sdktrace.NeverSample().ShouldSample(p)
+	}
+	attrs := attribute.NewSet(p.Attributes...)
+
+	for _, rule := range s.force {
+		if v, ok := attrs.Value(attribute.Key(rule.Attribute)); ok && v.Emit() == rule.Value {
+			setSamplingReason(p.ParentContext, decisionForced)
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+	// Every other rule applies a ratio
+	setSamplingReason(p.ParentContext, decisionDroppedByRatio)
+
+	tenant := baggage.FromContext(p.ParentContext).Member(string(s.tenantAttribute)).Value()
+	if v, ok := attrs.Value(s.tenantAttribute); ok {
+		tenant = v.Emit()
+	}
+	if sampler, ok := s.tenants[tenant]; ok && tenant != "" {
+		return sampler.ShouldSample(p)
+	}
+
+	route, ok := attrs.Value("http.route")
+	if !ok {
+		route, ok = attrs.Value("url.path")
+	}
+	if sampler, found := s.routes[route.Emit()]; ok && found {
+		return sampler.ShouldSample(p)
+	}
+
+	return s.defaultSampler.ShouldSample(p)
+}
+
+func (s *policySampler) Description() string {
+	return "PolicySampler"
+}
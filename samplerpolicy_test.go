@@ -0,0 +1,163 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testSamplerPolicy = `{
+	"default_ratio": 0,
+	"routes": {"/orders": 1, "/health": 0},
+	"tenants": {"acme": 1, "globex": 0},
+	"force_sample": [{"attribute": "priority", "value": "high"}]
+}`
+
+func writeSamplerPolicy(t *testing.T, policy string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sampler.json")
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0o600))
+	return path
+}
+
+func samplingDecision(sampler sdktrace.Sampler, ctx context.Context, attrs ...attribute.KeyValue) sdktrace.SamplingDecision {
+	return sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       trace.TraceID{0x01},
+		Name:          "span",
+		Attributes:    attrs,
+	}).Decision
+}
+
+func TestLoadSamplerFromFile(t *testing.T) {
+	sampler, err := LoadSamplerFromFile(writeSamplerPolicy(t, testSamplerPolicy))
+	require.NoError(t, err)
+
+	member, err := baggage.NewMember("tenant.id", "acme")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	acmeCtx := baggage.ContextWithBaggage(context.Background(), bag)
+	parentCtx := func(flags trace.TraceFlags) context.Context {
+		return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01},
+			SpanID:     trace.SpanID{0x02},
+			TraceFlags: flags,
+		}))
+	}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		attrs []attribute.KeyValue
+		want  sdktrace.SamplingDecision
+	}{
+		{name: "default ratio", want: sdktrace.Drop},
+		{name: "route ratio", attrs: []attribute.KeyValue{attribute.String("http.route", "/orders")}, want: sdktrace.RecordAndSample},
+		{name: "path fallback", attrs: []attribute.KeyValue{attribute.String("url.path", "/orders")}, want: sdktrace.RecordAndSample},
+		{name: "tenant overrides route", attrs: []attribute.KeyValue{
+			attribute.String("tenant.id", "globex"),
+			attribute.String("http.route", "/orders"),
+		}, want: sdktrace.Drop},
+		{name: "tenant from baggage", ctx: acmeCtx, attrs: []attribute.KeyValue{attribute.String("http.route", "/health")}, want: sdktrace.RecordAndSample},
+		{name: "force sample", attrs: []attribute.KeyValue{
+			attribute.String("priority", "high"),
+			attribute.String("tenant.id", "globex"),
+		}, want: sdktrace.RecordAndSample},
+		{name: "child of a sampled parent", ctx: parentCtx(trace.FlagsSampled), want: sdktrace.RecordAndSample},
+		{name: "child of an unsampled parent", ctx: parentCtx(0), attrs: []attribute.KeyValue{
+			attribute.String("priority", "high"),
+		}, want: sdktrace.Drop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			require.Equal(t, tt.want, samplingDecision(sampler, ctx, tt.attrs...))
+		})
+	}
+}
+
+func TestLoadSamplerFromFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{name: "malformed", policy: `{`, wantErr: "unexpected EOF"},
+		{name: "unknown field", policy: `{"ratio": 1}`, wantErr: `unknown field "ratio"`},
+		{name: "ratio out of range", policy: `{"routes": {"/orders": 1.5}}`, wantErr: `routes["/orders"]: ratio 1.5 out of range [0, 1]`},
+		{name: "missing attribute", policy: `{"force_sample": [{"value": "high"}]}`, wantErr: "force_sample[0]: attribute is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSamplerFromFile(writeSamplerPolicy(t, tt.policy))
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := LoadSamplerFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestWatchSamplerFile(t *testing.T) {
+	var logs lockedBuffer
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := writeSamplerPolicy(t, `{"default_ratio": 0}`)
+	sampler, err := WatchSamplerFile(ctx, path, 5*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, sdktrace.Drop, samplingDecision(sampler, ctx))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"default_ratio": 1}`), 0o600))
+	require.Eventually(t, func() bool {
+		return samplingDecision(sampler, ctx) == sdktrace.RecordAndSample
+	}, time.Second, time.Millisecond)
+
+	// An invalid update keeps the previous policy
+	require.NoError(t, os.WriteFile(path, []byte(`{"default_ratio": 2}`), 0o600))
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "invalid sampler policy")
+	}, time.Second, time.Millisecond)
+	require.Equal(t, sdktrace.RecordAndSample, samplingDecision(sampler, ctx))
+}
+
+// lockedBuffer is a bytes.Buffer that a background goroutine can log to while
+// the test reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,185 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the tracer name used by the package-level span helpers.
+const instrumentationName = "github.com/polymerdao/telemetry"
+
+// maxFeatureFlags bounds the number of flag attributes AnnotateFlags adds to a span.
+const maxFeatureFlags = 32
+
+// Limits applied by AddEvent and SetAttributes; see SetAttributeLimits.
+var (
+	maxAttributesPerCall    atomic.Int64
+	maxAttributeValueLength atomic.Int64
+)
+
+func init() {
+	maxAttributesPerCall.Store(64)
+	maxAttributeValueLength.Store(4096)
+}
+
+// SetAttributeLimits sets how many attributes a single AddEvent or SetAttributes
+// call records and the maximum length in bytes of their string values. Extra
+// attributes are dropped and longer values are cut and end with "...". The
+// defaults are 64 attributes and 4096 bytes; a limit <= 0 disables it.
+func SetAttributeLimits(perCall, valueLength int) {
+	maxAttributesPerCall.Store(int64(perCall))
+	maxAttributeValueLength.Store(int64(valueLength))
+}
+
+// AddEvent adds an event to the span in ctx, applying the limits set by
+// SetAttributeLimits to its attributes.
+func AddEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent(name, trace.WithAttributes(limitAttributes(attrs)...))
+}
+
+// RecordError records err as an exception event on the span in ctx and sets the
+// span status to error with the error message. It does nothing when err is nil or
+// ctx carries no recording span, so it is safe to call unconditionally.
+func RecordError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err == nil || !span.IsRecording() {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// SetAttributes sets attributes on the span in ctx, applying the limits set by
+// SetAttributeLimits.
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(limitAttributes(attrs)...)
+}
+
+// limitAttributes keeps the first attributes up to the per-call limit and
+// truncates their string values.
+func limitAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if limit := int(maxAttributesPerCall.Load()); limit > 0 && len(attrs) > limit {
+		attrs = attrs[:limit]
+	}
+	valueLength := int(maxAttributeValueLength.Load())
+	if valueLength <= 0 {
+		return attrs
+	}
+	limited := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		switch attr.Value.Type() {
+		case attribute.STRING:
+			attr.Value = attribute.StringValue(truncateString(attr.Value.AsString(), valueLength))
+		case attribute.STRINGSLICE:
+			values := attr.Value.AsStringSlice()
+			for j, v := range values {
+				values[j] = truncateString(v, valueLength)
+			}
+			attr.Value = attribute.StringSliceValue(values)
+		}
+		limited[i] = attr
+	}
+	return limited
+}
+
+// SpanWithTimeout starts a span whose context expires after d. If the deadline is
+// exceeded before the span ends, a "timeout" event is added, the span status is set
+// to error and the span is ended. The returned CancelFunc must be called to release
+// the context resources, as with context.WithTimeout.
+func SpanWithTimeout(ctx context.Context, name string, d time.Duration) (context.Context, trace.Span, context.CancelFunc) {
+	ctx, span := tracerFor(ctx, otel.Tracer(instrumentationName)).Start(ctx, name)
+	ctx, cancel := context.WithTimeout(ctx, d)
+
+	context.AfterFunc(ctx, func() {
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) || !span.IsRecording() {
+			return
+		}
+		span.AddEvent("timeout", trace.WithAttributes(
+			attribute.Int64("timeout_ms", d.Milliseconds()),
+		))
+		span.SetStatus(codes.Error, "operation timed out")
+		span.End()
+	})
+
+	return ctx, span, cancel
+}
+
+// StartChildOf starts a span whose parent is the given remote span context, such as
+// one restored from stored data. Unlike GetParentContext, the parent span ID is kept
+// so the new span attaches to that exact span rather than to the trace root.
+func StartChildOf(ctx context.Context, parent trace.SpanContext, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	return tracerFor(ctx, otel.Tracer(instrumentationName)).Start(ctx, name, opts...)
+}
+
+// AnnotateFlags records evaluated feature flags on the span in ctx as
+// feature_flag.<name> attributes. At most maxFeatureFlags flags are recorded,
+// taken in name order so the selection is stable across requests.
+func AnnotateFlags(ctx context.Context, flags map[string]bool) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() || len(flags) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if len(names) > maxFeatureFlags {
+		names = names[:maxFeatureFlags]
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, attribute.Bool("feature_flag."+name, flags[name]))
+	}
+	span.SetAttributes(attrs...)
+}
+
+// DetachTrace returns a copy of ctx without its span, so the next span started
+// from it begins a new root trace. Deadlines, cancellation and other values are
+// preserved. Use it for background work that should not join the request trace.
+func DetachTrace(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+}
+
+// RetrySpan starts a span for one attempt of a retried operation. The span is
+// tagged with retry.attempt and, when prev is valid, linked to the span of the
+// previous attempt so the attempts form a chain:
+//
+//	var prev trace.SpanContext
+//	for attempt := 1; attempt <= maxAttempts; attempt++ {
+//		ctx, span := telemetry.RetrySpan(ctx, "fetch", attempt, prev)
+//		prev = span.SpanContext()
+//		err = fetch(ctx)
+//		span.End()
+//	}
+func RetrySpan(ctx context.Context, name string, attempt int, prev trace.SpanContext) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(attribute.Int("retry.attempt", attempt)),
+	}
+	if prev.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{
+			SpanContext: prev,
+			Attributes:  []attribute.KeyValue{attribute.String("link.type", "previous_attempt")},
+		}))
+	}
+	return tracerFor(ctx, otel.Tracer(instrumentationName)).Start(ctx, name, opts...)
+}
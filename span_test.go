@@ -0,0 +1,193 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setTestTracerProvider installs a global TracerProvider backed by a span recorder
+// and restores the previous provider when the test ends.
+func setTestTracerProvider(t *testing.T, opts ...sdktrace.TracerProviderOption) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithSpanProcessor(recorder)}, opts...)...)
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestSpanWithTimeout(t *testing.T) {
+	t.Run("timeout exceeded", func(t *testing.T) {
+		recorder := setTestTracerProvider(t)
+
+		ctx, _, cancel := SpanWithTimeout(context.Background(), "slow-op", 10*time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+
+		require.Eventually(t, func() bool { return len(recorder.Ended()) == 1 }, time.Second, time.Millisecond)
+		span := recorder.Ended()[0]
+		require.Equal(t, "slow-op", span.Name())
+		require.Equal(t, codes.Error, span.Status().Code)
+		require.Len(t, span.Events(), 1)
+		require.Equal(t, "timeout", span.Events()[0].Name)
+	})
+
+	t.Run("finished in time", func(t *testing.T) {
+		recorder := setTestTracerProvider(t)
+
+		_, span, cancel := SpanWithTimeout(context.Background(), "fast-op", time.Second)
+		span.End()
+		cancel()
+
+		require.Len(t, recorder.Ended(), 1)
+		require.Empty(t, recorder.Ended()[0].Events())
+		require.Equal(t, codes.Unset, recorder.Ended()[0].Status().Code)
+	})
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	// Without a span, or without an error, nothing happens
+	RecordError(context.Background(), errors.New("ignored"))
+	ctx, span := otel.Tracer("test").Start(context.Background(), "op")
+	RecordError(ctx, nil)
+	RecordError(ctx, fmt.Errorf("query failed: %w", context.DeadlineExceeded))
+	span.End()
+
+	require.Len(t, recorder.Ended(), 1)
+	ended := recorder.Ended()[0]
+	require.Equal(t, codes.Error, ended.Status().Code)
+	require.Equal(t, "query failed: context deadline exceeded", ended.Status().Description)
+	require.Len(t, ended.Events(), 1)
+	require.Equal(t, "exception", ended.Events()[0].Name)
+}
+
+func TestStartChildOf(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	_, span := StartChildOf(context.Background(), parent, "child")
+	span.End()
+
+	require.Len(t, recorder.Ended(), 1)
+	child := recorder.Ended()[0]
+	require.Equal(t, parent.TraceID(), child.SpanContext().TraceID())
+	require.Equal(t, parent.SpanID(), child.Parent().SpanID())
+	require.True(t, child.Parent().IsRemote())
+}
+
+func TestAnnotateFlags(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	flags := map[string]bool{"new_checkout": true, "dark_mode": false}
+	for i := range maxFeatureFlags {
+		flags[fmt.Sprintf("zz_flag_%02d", i)] = true
+	}
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	AnnotateFlags(ctx, flags)
+	span.End()
+
+	attrs := map[string]bool{}
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsBool()
+	}
+	require.Len(t, attrs, maxFeatureFlags)
+	require.Equal(t, true, attrs["feature_flag.new_checkout"])
+	require.Equal(t, false, attrs["feature_flag.dark_mode"])
+	require.NotContains(t, attrs, fmt.Sprintf("feature_flag.zz_flag_%02d", maxFeatureFlags-1))
+}
+
+func TestDetachTrace(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	type key struct{}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), time.Minute)
+	defer cancel()
+	ctx, parent := otel.Tracer("test").Start(ctx, "request")
+	defer parent.End()
+
+	detached := DetachTrace(ctx)
+	require.Equal(t, "value", detached.Value(key{}))
+	_, hasDeadline := detached.Deadline()
+	require.True(t, hasDeadline)
+
+	_, job := otel.Tracer("test").Start(detached, "job")
+	job.End()
+
+	require.Len(t, recorder.Ended(), 1)
+	span := recorder.Ended()[0]
+	require.False(t, span.Parent().IsValid())
+	require.NotEqual(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+}
+
+func TestRetrySpan(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	var prev trace.SpanContext
+	for attempt := 1; attempt <= 3; attempt++ {
+		_, span := RetrySpan(context.Background(), "fetch", attempt, prev)
+		prev = span.SpanContext()
+		span.End()
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	require.Empty(t, spans[0].Links())
+	for i, span := range spans {
+		require.Equal(t, "fetch", span.Name())
+		require.Contains(t, span.Attributes(), attribute.Int("retry.attempt", i+1))
+		if i > 0 {
+			require.Len(t, span.Links(), 1)
+			require.Equal(t, spans[i-1].SpanContext().SpanID(), span.Links()[0].SpanContext.SpanID())
+		}
+	}
+}
+
+func TestAttributeLimits(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	SetAttributeLimits(2, 8)
+	t.Cleanup(func() { SetAttributeLimits(64, 4096) })
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "capped")
+	SetAttributes(ctx,
+		attribute.String("short", "value"),
+		attribute.String("long", "0123456789"),
+		attribute.String("dropped", "value"),
+	)
+	AddEvent(ctx, "event", attribute.StringSlice("list", []string{"abc", "0123456789"}), attribute.Int("count", 1), attribute.Int("dropped", 1))
+	span.End()
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("short", "value"),
+		attribute.String("long", "01234..."),
+	}, ended[0].Attributes())
+	require.Len(t, ended[0].Events(), 1)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.StringSlice("list", []string{"abc", "01234..."}),
+		attribute.Int("count", 1),
+	}, ended[0].Events()[0].Attributes)
+}
@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"net/http"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// spanKindOf returns the kind of span, or SpanKindServer when it is not known,
+// as for spans that do not come from the SDK.
+func spanKindOf(span trace.Span) trace.SpanKind {
+	if s, ok := span.(interface{ SpanKind() trace.SpanKind }); ok {
+		return s.SpanKind()
+	}
+	return trace.SpanKindServer
+}
+
+// SetStatusFromHTTP sets the status of span from an HTTP response status code,
+// following the OpenTelemetry semantic conventions: 5xx codes are errors, 4xx
+// codes are errors on client spans only, as they are caused by the client, and
+// other codes leave the status unset. Spans of unknown kind are treated as
+// server spans.
+func SetStatusFromHTTP(span trace.Span, code int) {
+	if httpStatusIsError(spanKindOf(span), code) {
+		span.SetStatus(otelcodes.Error, "")
+	}
+}
+
+func httpStatusIsError(kind trace.SpanKind, code int) bool {
+	if code < 100 || code >= http.StatusInternalServerError {
+		return true
+	}
+	return code >= http.StatusBadRequest && kind == trace.SpanKindClient
+}
+
+// SetStatusFromGRPC sets the status of span from a gRPC status code, following
+// the OpenTelemetry semantic conventions: every code but OK is an error on client
+// spans, while server spans only fail for codes that point at the server, such as
+// Internal or Unavailable, and not for client errors such as NotFound. Spans of
+// unknown kind are treated as server spans.
+func SetStatusFromGRPC(span trace.Span, code codes.Code) {
+	if grpcStatusIsError(spanKindOf(span), code) {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+}
+
+func grpcStatusIsError(kind trace.SpanKind, code codes.Code) bool {
+	if code == codes.OK {
+		return false
+	}
+	if kind == trace.SpanKindClient {
+		return true
+	}
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
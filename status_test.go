@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+)
+
+func TestSetStatusFromHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		kind trace.SpanKind
+		code int
+		want otelcodes.Code
+	}{
+		{name: "server ok", kind: trace.SpanKindServer, code: http.StatusOK, want: otelcodes.Unset},
+		{name: "server not found", kind: trace.SpanKindServer, code: http.StatusNotFound, want: otelcodes.Unset},
+		{name: "server unavailable", kind: trace.SpanKindServer, code: http.StatusServiceUnavailable, want: otelcodes.Error},
+		{name: "client not found", kind: trace.SpanKindClient, code: http.StatusNotFound, want: otelcodes.Error},
+		{name: "client redirect", kind: trace.SpanKindClient, code: http.StatusFound, want: otelcodes.Unset},
+		{name: "invalid code", kind: trace.SpanKindServer, code: 42, want: otelcodes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			_, span := otel.Tracer("test").Start(context.Background(), "op", trace.WithSpanKind(tt.kind))
+			SetStatusFromHTTP(span, tt.code)
+			span.End()
+			require.Equal(t, tt.want, recorder.Ended()[0].Status().Code)
+		})
+	}
+}
+
+func TestSetStatusFromGRPC(t *testing.T) {
+	tests := []struct {
+		name string
+		kind trace.SpanKind
+		code codes.Code
+		want otelcodes.Code
+	}{
+		{name: "server ok", kind: trace.SpanKindServer, code: codes.OK, want: otelcodes.Unset},
+		{name: "server not found", kind: trace.SpanKindServer, code: codes.NotFound, want: otelcodes.Unset},
+		{name: "server unavailable", kind: trace.SpanKindServer, code: codes.Unavailable, want: otelcodes.Error},
+		{name: "client not found", kind: trace.SpanKindClient, code: codes.NotFound, want: otelcodes.Error},
+		{name: "client ok", kind: trace.SpanKindClient, code: codes.OK, want: otelcodes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			_, span := otel.Tracer("test").Start(context.Background(), "op", trace.WithSpanKind(tt.kind))
+			SetStatusFromGRPC(span, tt.code)
+			span.End()
+			require.Equal(t, tt.want, recorder.Ended()[0].Status().Code)
+		})
+	}
+}
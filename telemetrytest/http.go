@@ -0,0 +1,34 @@
+package telemetrytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ServeAndCapture runs req through h and returns the spans ended while serving it,
+// together with the recorded response. It lets tests assert the attributes set by
+// telemetry.TracingMiddleware without a backend:
+//
+//	spans, resp := telemetrytest.ServeAndCapture(telemetry.TracingMiddleware(handler), req)
+//
+// The global TracerProvider is replaced by an in-memory one for the duration of the
+// call, so it must not run in parallel with other tests that use the global provider.
+func ServeAndCapture(h http.Handler, req *http.Request) (tracetest.SpanStubs, *http.Response) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	// The syncer exports spans as they end; shutting down would clear the exporter.
+	spans := exporter.GetSpans()
+	_ = tp.Shutdown(req.Context())
+	return spans, rec.Result()
+}
@@ -0,0 +1,25 @@
+package telemetrytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestServeAndCapture(t *testing.T) {
+	handler := telemetry.TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	spans, resp := ServeAndCapture(handler, httptest.NewRequest(http.MethodGet, "/items", nil))
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+	require.Len(t, spans, 1)
+	require.Equal(t, "GET /items", spans[0].Name)
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+	require.Contains(t, spans[0].Attributes, attribute.String("server.type", "http"))
+}
@@ -0,0 +1,80 @@
+package telemetrytest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AssertNoLeakedSpans fails the test if a span started through the global
+// TracerProvider is still unfinished when the test ends, which usually means a
+// missing span.End(). Call it at the start of the test:
+//
+//	func TestHandler(t *testing.T) {
+//		telemetrytest.AssertNoLeakedSpans(t)
+//		...
+//	}
+//
+// It replaces the global TracerProvider with one sampling every span until the
+// test ends, so it must not run in parallel with other tests that use the global
+// provider.
+func AssertNoLeakedSpans(t testing.TB) {
+	t.Helper()
+	tracker := &spanTracker{}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(tracker),
+	)
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+		if leaked := tracker.unfinished(); len(leaked) > 0 {
+			t.Errorf("%d span(s) not ended: %s", len(leaked), strings.Join(leaked, ", "))
+		}
+	})
+}
+
+type spanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// spanTracker records the names of the spans started but not yet ended.
+type spanTracker struct {
+	spans sync.Map // spanKey -> name
+}
+
+func (p *spanTracker) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	p.spans.Store(keyOf(s), s.Name())
+}
+
+func (p *spanTracker) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.spans.Delete(keyOf(s))
+}
+
+func (p *spanTracker) Shutdown(context.Context) error   { return nil }
+func (p *spanTracker) ForceFlush(context.Context) error { return nil }
+
+func (p *spanTracker) unfinished() []string {
+	var names []string
+	p.spans.Range(func(_, name any) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+func keyOf(s sdktrace.ReadOnlySpan) spanKey {
+	sc := s.SpanContext()
+	return spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+}
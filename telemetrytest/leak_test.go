@@ -0,0 +1,65 @@
+package telemetrytest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+// recordingTB captures failures and runs cleanups on demand, so a test can
+// assert that a helper fails without failing itself.
+type recordingTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper()          {}
+func (r *recordingTB) Cleanup(f func()) { r.cleanups = append(r.cleanups, f) }
+func (r *recordingTB) Errorf(f string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(f, args...))
+}
+
+func (r *recordingTB) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestAssertNoLeakedSpans(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    func()
+		errors []string
+	}{
+		{
+			name: "all ended",
+			run: func() {
+				_, span := otel.Tracer("test").Start(context.Background(), "done")
+				span.End()
+			},
+		},
+		{
+			name: "leaked span",
+			run: func() {
+				ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+				_, _ = otel.Tracer("test").Start(ctx, "forgotten")
+				parent.End()
+			},
+			errors: []string{"1 span(s) not ended: forgotten"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+			AssertNoLeakedSpans(tb)
+			tt.run()
+			tb.finish()
+			require.Equal(t, tt.errors, tb.errors)
+		})
+	}
+}
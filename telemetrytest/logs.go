@@ -0,0 +1,89 @@
+package telemetrytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+)
+
+// LogEntry is one decoded JSON log record.
+type LogEntry map[string]any
+
+// TraceID returns the Cloud Logging trace field of the entry.
+func (e LogEntry) TraceID() string {
+	id, _ := e["logging.googleapis.com/trace"].(string)
+	return id
+}
+
+// LogCapture records the logs written through the default slog logger.
+type LogCapture struct {
+	t testing.TB
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// CaptureLogs configures the default logger with telemetry.SetupLoggingWithWriter
+// at debug level in JSON format, writing to an in-memory buffer. The previous
+// default logger is restored when the test ends.
+func CaptureLogs(t testing.TB, opts ...telemetry.LoggingOption) *LogCapture {
+	t.Helper()
+	c := &LogCapture{t: t}
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	telemetry.SetupLoggingWithWriter("debug", "json", c, opts...)
+	return c
+}
+
+func (c *LogCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+// Entries returns every captured entry in order.
+func (c *LogCapture) Entries() []LogEntry {
+	c.t.Helper()
+	c.mu.Lock()
+	data := bytes.Clone(c.buf.Bytes())
+	c.mu.Unlock()
+
+	var entries []LogEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			c.t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// LastEntry returns the most recent entry, or nil if nothing was logged.
+func (c *LogCapture) LastEntry() LogEntry {
+	c.t.Helper()
+	entries := c.Entries()
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries[len(entries)-1]
+}
+
+// EntriesWithTrace returns the entries logged under the trace with the given hex ID.
+func (c *LogCapture) EntriesWithTrace(traceID string) []LogEntry {
+	c.t.Helper()
+	var entries []LogEntry
+	for _, entry := range c.Entries() {
+		if entry.TraceID() == traceID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
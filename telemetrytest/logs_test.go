@@ -0,0 +1,33 @@
+package telemetrytest
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCaptureLogs(t *testing.T) {
+	logs := CaptureLogs(t)
+	require.Nil(t, logs.LastEntry())
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	slog.InfoContext(ctx, "in span")
+	slog.Debug("outside span")
+
+	require.Len(t, logs.Entries(), 2)
+	require.Equal(t, "outside span", logs.LastEntry()["message"])
+
+	traced := logs.EntriesWithTrace(sc.TraceID().String())
+	require.Len(t, traced, 1)
+	require.Equal(t, "in span", traced[0]["message"])
+	require.Equal(t, sc.TraceID().String(), traced[0].TraceID())
+}
@@ -0,0 +1,97 @@
+// Package telemetrytest provides helpers for testing code instrumented with the
+// telemetry package.
+package telemetrytest
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPReceiver is an in-process OTLP/HTTP trace receiver that records the
+// spans posted to it.
+type OTLPReceiver struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	resourceSpans []*tracepb.ResourceSpans
+}
+
+// NewOTLPReceiver starts a receiver that is closed when the test ends.
+func NewOTLPReceiver(t testing.TB) *OTLPReceiver {
+	t.Helper()
+	r := &OTLPReceiver{}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.handle))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+// Endpoint returns the base URL to use as OTEL_EXPORTER_OTLP_ENDPOINT.
+func (r *OTLPReceiver) Endpoint() string {
+	return r.srv.URL
+}
+
+// ResourceSpans returns every batch received so far.
+func (r *OTLPReceiver) ResourceSpans() []*tracepb.ResourceSpans {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*tracepb.ResourceSpans(nil), r.resourceSpans...)
+}
+
+// Spans returns every span received so far.
+func (r *OTLPReceiver) Spans() []*tracepb.Span {
+	var spans []*tracepb.Span
+	for _, rs := range r.ResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			spans = append(spans, ss.GetSpans()...)
+		}
+	}
+	return spans
+}
+
+func (r *OTLPReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != "/v1/traces" {
+		http.NotFound(w, req)
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var export collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(data, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.resourceSpans = append(r.resourceSpans, export.GetResourceSpans()...)
+	r.mu.Unlock()
+
+	resp, err := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
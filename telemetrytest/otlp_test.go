@@ -0,0 +1,39 @@
+package telemetrytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestOTLPReceiver(t *testing.T) {
+	receiver := NewOTLPReceiver(t)
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", receiver.Endpoint())
+	t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", "gzip")
+
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	shutdown, err := telemetry.InitTracer(context.Background(), "receiver-test")
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "exported-span")
+	span.End()
+	// Shutdown flushes the batch processor
+	require.NoError(t, shutdown(context.Background()))
+
+	spans := receiver.Spans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "exported-span", spans[0].GetName())
+
+	var serviceName string
+	for _, kv := range receiver.ResourceSpans()[0].GetResource().GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			serviceName = kv.GetValue().GetStringValue()
+		}
+	}
+	require.Equal(t, "receiver-test", serviceName)
+}
@@ -0,0 +1,72 @@
+package telemetrytest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/polymerdao/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// RoundTrip simulates a call between two services: req is sent by client to server,
+// which runs behind a local HTTP server. It returns the spans ended by both sides
+// and the response, whose body has been read. It lets tests assert that the trace
+// continues across the call:
+//
+//	client := &http.Client{Transport: telemetry.NewTracingTransport(nil)}
+//	spans, resp, err := telemetrytest.RoundTrip(client, telemetry.TracingMiddleware(handler), req)
+//
+// The request URL only needs a path; the scheme and host are those of the local
+// server. A nil client uses telemetry.NewTracingTransport. As with ServeAndCapture,
+// the global TracerProvider and propagator are replaced for the duration of the
+// call, so it must not run in parallel with other tests that use them.
+func RoundTrip(client *http.Client, server http.Handler, req *http.Request) (tracetest.SpanStubs, *http.Response, error) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = target.Scheme, target.Host, ""
+	req.RequestURI = ""
+
+	if client == nil {
+		client = &http.Client{Transport: telemetry.NewTracingTransport(nil)}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Read the body before the server closes.
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The server span may end after the client has read the response.
+	srv.Close()
+	spans := exporter.GetSpans()
+	_ = tp.Shutdown(context.Background())
+	return spans, resp, nil
+}
@@ -0,0 +1,40 @@
+package telemetrytest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRoundTrip(t *testing.T) {
+	server := telemetry.TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	spans, resp, err := RoundTrip(nil, server, httptest.NewRequest(http.MethodGet, "/items", nil))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(body))
+
+	require.Len(t, spans, 2)
+	var client, srv tracetest.SpanStub
+	for _, span := range spans {
+		switch span.SpanKind {
+		case trace.SpanKindClient:
+			client = span
+		case trace.SpanKindServer:
+			srv = span
+		}
+	}
+	require.True(t, client.SpanContext.IsValid())
+	require.Equal(t, client.SpanContext.TraceID(), srv.SpanContext.TraceID())
+	require.Equal(t, client.SpanContext.SpanID(), srv.Parent.SpanID())
+	require.True(t, srv.Parent.IsRemote())
+}
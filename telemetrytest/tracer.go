@@ -0,0 +1,39 @@
+package telemetrytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// InitTracer initializes tracing with telemetry.InitTracer, like a service does,
+// but exports every span synchronously to the returned in-memory exporter. Spans
+// can be inspected with GetSpans as soon as they end:
+//
+//	exporter := telemetrytest.InitTracer(t)
+//	_, span := telemetry.NewTracer("orders").Span(ctx)
+//	span.End()
+//	require.Len(t, exporter.GetSpans(), 1)
+//
+// opts are passed to telemetry.InitTracer. The global TracerProvider and
+// propagator are restored when the test ends, so it must not run in parallel with
+// other tests that use them.
+func InitTracer(t testing.TB, opts ...telemetry.TracerOption) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	shutdown, err := telemetry.InitTracer(context.Background(), "test-service",
+		append(opts, telemetry.WithSyncExporter(exporter))...)
+	if err != nil {
+		t.Fatalf("failed to initialize tracing: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = shutdown(context.Background())
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return exporter
+}
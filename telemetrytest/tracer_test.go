@@ -0,0 +1,28 @@
+package telemetrytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/polymerdao/telemetry"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInitTracer(t *testing.T) {
+	exporter := InitTracer(t)
+
+	ctx, parent := telemetry.NewTracer("orders").Span(context.Background())
+	_, child := telemetry.NewTracer("orders").Span(ctx, trace.WithAttributes(attribute.String("order.id", "42")))
+	child.End()
+	require.Len(t, exporter.GetSpans(), 1, "spans are exported as soon as they end")
+
+	parent.End()
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	require.Contains(t, spans[0].Attributes, attribute.String("order.id", "42"))
+	serviceName, _ := spans[1].Resource.Set().Value("service.name")
+	require.Equal(t, "test-service", serviceName.AsString())
+}
@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TimeoutOption configures TimeoutMiddleware.
+type TimeoutOption func(*timeoutConfig)
+
+type timeoutConfig struct {
+	routes map[string]time.Duration
+}
+
+// WithRouteTimeout overrides the timeout for requests whose path is exactly path.
+func WithRouteTimeout(path string, d time.Duration) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.routes[path] = d
+	}
+}
+
+// TimeoutMiddleware returns a middleware that cancels the request context after d,
+// or the timeout of the request's route, and responds with 503 Service Unavailable
+// when the handler has not finished by then. The span in the request context gets
+// a "timeout" event and an error status, so it must be placed inside
+// TracingMiddleware. Responses are buffered as with http.TimeoutHandler.
+func TimeoutMiddleware(d time.Duration, opts ...TimeoutOption) func(http.Handler) http.Handler {
+	cfg := &timeoutConfig{routes: make(map[string]time.Duration)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		handlers := make(map[string]http.Handler, len(cfg.routes))
+		for path, routeTimeout := range cfg.routes {
+			handlers[path] = newTimeoutHandler(next, routeTimeout)
+		}
+		fallback := newTimeoutHandler(next, d)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h, ok := handlers[r.URL.Path]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			fallback.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newTimeoutHandler(next http.Handler, d time.Duration) http.Handler {
+	handler := http.TimeoutHandler(next, d, http.StatusText(http.StatusServiceUnavailable))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The deadline is set here so it can be checked once http.TimeoutHandler
+		// returns. Its own context, derived from this one with the same timeout,
+		// is done at the same time.
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		var status int
+		w = httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					status = code
+					next(code)
+				}
+			},
+		})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+
+		// A handler may answer 503 itself, and one finishing just before the
+		// deadline is not a timeout, so both conditions are required.
+		if status != http.StatusServiceUnavailable || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.AddEvent("timeout", trace.WithAttributes(
+			attribute.Int64("timeout_ms", d.Milliseconds()),
+		))
+		span.SetStatus(codes.Error, "request timed out")
+	})
+}
@@ -0,0 +1,52 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	timeout := TimeoutMiddleware(10*time.Millisecond, WithRouteTimeout("/export", 5*time.Second))
+
+	tests := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		wantTimeout bool
+	}{
+		{name: "default timeout", path: "/items", wantStatus: http.StatusServiceUnavailable, wantTimeout: true},
+		{name: "route override", path: "/export", wantStatus: http.StatusOK, wantTimeout: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setTestTracerProvider(t)
+			handler := TracingMiddleware(timeout(slow))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.Equal(t, tt.wantStatus, rec.Code)
+
+			require.Len(t, recorder.Ended(), 1)
+			span := recorder.Ended()[0]
+			if tt.wantTimeout {
+				require.Equal(t, codes.Error, span.Status().Code)
+				require.Len(t, span.Events(), 1)
+				require.Equal(t, "timeout", span.Events()[0].Name)
+			} else {
+				require.Empty(t, span.Events())
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanSummary is the per-span entry of a consolidated trace log.
+type spanSummary struct {
+	Name         string  `json:"name"`
+	SpanID       string  `json:"span_id"`
+	ParentSpanID string  `json:"parent_span_id,omitempty"`
+	DurationMS   float64 `json:"duration_ms"`
+	Status       string  `json:"status"`
+}
+
+// maxPendingTraces bounds the traces buffered by NewTraceLogProcessor, so traces
+// whose root never ends, such as a leaked span, cannot grow the buffer forever.
+const maxPendingTraces = 1024
+
+// NewTraceLogProcessor returns a span processor that writes one log line per
+// finished trace instead of one per span. Spans are buffered by trace ID until
+// the local root span (one without a local parent) ends, then a single
+// "trace summary" record listing every span and its duration is logged.
+// At most 1024 traces are buffered; beyond that, and on Shutdown, the oldest
+// pending traces are logged as incomplete. ForceFlush does not log pending
+// traces, as it is also called for live traces, for example by WithFlushOnError.
+// A nil logger uses slog.Default().
+func NewTraceLogProcessor(logger *slog.Logger) sdktrace.SpanProcessor {
+	return &traceLogProcessor{
+		logger:     logger,
+		maxPending: maxPendingTraces,
+		pending:    make(map[trace.TraceID]*list.Element),
+		order:      list.New(),
+	}
+}
+
+type traceLogProcessor struct {
+	logger     *slog.Logger
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[trace.TraceID]*list.Element
+	// order holds the pendingTrace values from the oldest.
+	order *list.List
+}
+
+// pendingTrace is the buffered spans of a trace whose root has not ended.
+type pendingTrace struct {
+	traceID trace.TraceID
+	spans   []sdktrace.ReadOnlySpan
+}
+
+func (p *traceLogProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *traceLogProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+	isRoot := !s.Parent().IsValid() || s.Parent().IsRemote()
+
+	p.mu.Lock()
+	var spans []sdktrace.ReadOnlySpan
+	var evicted *pendingTrace
+	if elem, ok := p.pending[traceID]; ok {
+		pt := elem.Value.(*pendingTrace)
+		pt.spans = append(pt.spans, s)
+		spans = pt.spans
+		if isRoot {
+			delete(p.pending, traceID)
+			p.order.Remove(elem)
+		}
+	} else if isRoot {
+		spans = []sdktrace.ReadOnlySpan{s}
+	} else {
+		if p.order.Len() >= p.maxPending {
+			evicted = p.order.Remove(p.order.Front()).(*pendingTrace)
+			delete(p.pending, evicted.traceID)
+		}
+		p.pending[traceID] = p.order.PushBack(&pendingTrace{traceID: traceID, spans: []sdktrace.ReadOnlySpan{s}})
+	}
+	p.mu.Unlock()
+
+	if evicted != nil {
+		p.log(nil, evicted.spans)
+	}
+	if isRoot {
+		p.log(s, spans)
+	}
+}
+
+// Shutdown logs the traces still pending as incomplete.
+func (p *traceLogProcessor) Shutdown(context.Context) error {
+	p.mu.Lock()
+	order := p.order
+	p.pending = make(map[trace.TraceID]*list.Element)
+	p.order = list.New()
+	p.mu.Unlock()
+
+	for elem := order.Front(); elem != nil; elem = elem.Next() {
+		p.log(nil, elem.Value.(*pendingTrace).spans)
+	}
+	return nil
+}
+
+// ForceFlush does nothing: a summary is only complete once the root span ends.
+func (p *traceLogProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// log writes the summary of spans. root is nil when the trace is flushed before its root ended.
+func (p *traceLogProcessor) log(root sdktrace.ReadOnlySpan, spans []sdktrace.ReadOnlySpan) {
+	logger := p.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	summaries := make([]spanSummary, 0, len(spans))
+	for _, s := range spans {
+		summary := spanSummary{
+			Name:       s.Name(),
+			SpanID:     s.SpanContext().SpanID().String(),
+			DurationMS: float64(s.EndTime().Sub(s.StartTime()).Microseconds()) / 1000,
+			Status:     s.Status().Code.String(),
+		}
+		if s.Parent().IsValid() {
+			summary.ParentSpanID = s.Parent().SpanID().String()
+		}
+		summaries = append(summaries, summary)
+	}
+
+	attrs := []any{
+		"trace_id", spans[0].SpanContext().TraceID().String(),
+		"span_count", len(spans),
+		"spans", summaries,
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), spans[0].SpanContext())
+	if root != nil {
+		ctx = trace.ContextWithSpanContext(context.Background(), root.SpanContext())
+		attrs = append(attrs,
+			"root", root.Name(),
+			"duration_ms", float64(root.EndTime().Sub(root.StartTime()).Microseconds())/1000,
+		)
+	} else {
+		attrs = append(attrs, "incomplete", true)
+	}
+	logger.InfoContext(ctx, "trace summary", attrs...)
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceLogProcessor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewTraceLogProcessor(logger)))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	require.Empty(t, buf.String(), "nothing is logged before the trace finishes")
+	root.End()
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	require.Equal(t, "trace summary", entry["msg"])
+	require.Equal(t, root.SpanContext().TraceID().String(), entry["trace_id"])
+	require.Equal(t, "root", entry["root"])
+	require.Equal(t, float64(2), entry["span_count"])
+
+	spans := entry["spans"].([]any)
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].(map[string]any)["name"])
+	require.Equal(t, root.SpanContext().SpanID().String(), spans[0].(map[string]any)["parent_span_id"])
+	require.Equal(t, "root", spans[1].(map[string]any)["name"])
+	require.Contains(t, spans[1].(map[string]any), "duration_ms")
+}
+
+func TestTraceLogProcessorPendingTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	processor := NewTraceLogProcessor(logger)
+	processor.(*traceLogProcessor).maxPending = 2
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	tracer := tp.Tracer("test")
+
+	// Each root stays open, so its trace is pending once the child ends
+	var roots []trace.Span
+	for range 3 {
+		ctx, root := tracer.Start(context.Background(), "root")
+		_, child := tracer.Start(ctx, "child")
+		child.End()
+		roots = append(roots, root)
+	}
+
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1, "the oldest trace is evicted past the bound")
+	require.Equal(t, roots[0].SpanContext().TraceID().String(), entries[0]["trace_id"])
+	require.Equal(t, true, entries[0]["incomplete"])
+
+	buf.Reset()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	require.Empty(t, buf.String(), "ForceFlush keeps live traces pending")
+
+	roots[1].End()
+	entries = logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	require.Equal(t, "root", entries[0]["root"])
+	require.Equal(t, float64(2), entries[0]["span_count"])
+
+	buf.Reset()
+	require.NoError(t, tp.Shutdown(context.Background()))
+	entries = logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	require.Equal(t, roots[2].SpanContext().TraceID().String(), entries[0]["trace_id"])
+	require.Equal(t, true, entries[0]["incomplete"])
+}
@@ -5,12 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
-	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -19,25 +25,155 @@ import (
 	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// defaultDroppedSpanNames are the exporter self-instrumentation spans dropped by
+// NewFilterSampler when no names are given.
+var defaultDroppedSpanNames = []string{"google.devtools.cloudtrace.v2.TraceService/BatchWriteSpans"}
+
+// NewFilterSampler returns a sampler that drops spans named in dropNames, such as
+// an exporter's own RPCs, and delegates every other span to base. It also honors
+// the per-request ratio set by the middleware's sample rate header. When dropNames
+// is empty, the Cloud Trace BatchWriteSpans RPC is dropped.
+func NewFilterSampler(base sdktrace.Sampler, dropNames ...string) sdktrace.Sampler {
+	return newFilterSampler(base, dropNames...)
+}
+
+func newFilterSampler(base sdktrace.Sampler, dropNames ...string) *filterSampler {
+	if len(dropNames) == 0 {
+		dropNames = defaultDroppedSpanNames
+	}
+	f := &filterSampler{
+		baseSampler: base,
+		dropNames:   make(map[string]struct{}, len(dropNames)),
+	}
+	for _, name := range dropNames {
+		f.dropNames[name] = struct{}{}
+	}
+	return f
+}
+
 type filterSampler struct {
 	baseSampler sdktrace.Sampler
+	dropNames   map[string]struct{}
+	// decisions counts the decisions by outcome when sampling metrics are enabled.
+	decisions metric.Int64Counter
 }
 
+// Outcomes recorded in the decision attribute of the sampling.decisions counter.
+const (
+	decisionSampled         = "sampled"
+	decisionForced          = "forced"
+	decisionDroppedByRatio  = "dropped_by_ratio"
+	decisionDroppedByName   = "dropped_by_name"
+	decisionDroppedByParent = "dropped_by_parent"
+	decisionDropped         = "dropped"
+)
+
+// samplingReasonKey is the context key of the slot in which the samplers of this
+// package report why they forced or dropped a span, for the sampling.decisions
+// counter. The filter sampler only adds the slot when the counter is enabled.
+type samplingReasonKey struct{}
+
+// setSamplingReason reports reason to the filter sampler counting the decision
+// made for ctx, if any.
+func setSamplingReason(ctx context.Context, reason string) {
+	if slot, ok := ctx.Value(samplingReasonKey{}).(*string); ok {
+		*slot = reason
+	}
+}
+
+// newSamplingDecisionCounter creates the sampling.decisions counter on the global
+// MeterProvider.
+func newSamplingDecisionCounter() metric.Int64Counter {
+	counter, err := otel.Meter(instrumentationName).Int64Counter("sampling.decisions",
+		metric.WithDescription("Number of sampling decisions by outcome"),
+		metric.WithUnit("{decision}"),
+	)
+	if err != nil {
+		slog.Warn("failed to create sampling.decisions counter", "error", err)
+		return nil
+	}
+	return counter
+}
+
+// DropSpanAttribute marks a span that the drop span processor must not export.
 var DropSpanAttribute = attribute.Bool("drop", true)
 
+// KeepSpanAttribute marks a span that must be exported. It takes precedence over
+// DropSpanAttribute, so a span carrying both is kept.
+var KeepSpanAttribute = attribute.Bool("keep", true)
+
 func (f *filterSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
 	// Drop specific spans by name
-	if p.Name == "google.devtools.cloudtrace.v2.TraceService/BatchWriteSpans" {
+	if _, ok := f.dropNames[p.Name]; ok {
+		f.record(p.ParentContext, decisionDroppedByName)
 		return sdktrace.SamplingResult{Decision: sdktrace.Drop}
 	}
-	return f.baseSampler.ShouldSample(p)
+	// Honor a per-request ratio set by the middleware's sample rate header
+	if rate, ok := sampleRateFromContext(p.ParentContext); ok {
+		result := sdktrace.TraceIDRatioBased(rate).ShouldSample(p)
+		if result.Decision == sdktrace.RecordAndSample {
+			f.record(p.ParentContext, decisionForced)
+		} else {
+			f.record(p.ParentContext, decisionDroppedByRatio)
+		}
+		return result
+	}
+	if f.decisions == nil {
+		return f.baseSampler.ShouldSample(p)
+	}
+
+	var reason string
+	ctx := p.ParentContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.ParentContext = context.WithValue(ctx, samplingReasonKey{}, &reason)
+	result := f.baseSampler.ShouldSample(p)
+	f.record(ctx, f.decisionOf(p, result, reason))
+	return result
+}
+
+// decisionOf labels the decision of the base sampler. reason is what the
+// samplers of this package reported; for other samplers, such as those of the
+// SDK, the reason for a drop is inferred from the parent and the description.
+func (f *filterSampler) decisionOf(p sdktrace.SamplingParameters, result sdktrace.SamplingResult, reason string) string {
+	if result.Decision == sdktrace.RecordAndSample {
+		if reason == decisionForced {
+			return decisionForced
+		}
+		return decisionSampled
+	}
+	if reason != "" && reason != decisionForced {
+		return reason
+	}
+	description := f.baseSampler.Description()
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	switch {
+	case parent.IsValid() && !parent.IsSampled() && strings.Contains(description, "ParentBased"):
+		return decisionDroppedByParent
+	case strings.Contains(description, "TraceIDRatioBased"):
+		return decisionDroppedByRatio
+	default:
+		return decisionDropped
+	}
+}
+
+func (f *filterSampler) record(ctx context.Context, decision string) {
+	if f.decisions == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f.decisions.Add(ctx, 1, metric.WithAttributes(attribute.String("decision", decision)))
 }
 
 func (f *filterSampler) Description() string {
 	return fmt.Sprintf("FilterSampler{%s}", f.baseSampler.Description())
 }
 
-// NewDropSpanProcessor returns a custom span processor that drops spans with the DropSpanAttribute set.
+// NewDropSpanProcessor returns a custom span processor that drops spans with the DropSpanAttribute set,
+// unless the KeepSpanAttribute is also set.
 func NewDropSpanProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
 	return &dropSpanProcessor{
 		processor: next,
@@ -53,13 +189,20 @@ func (d *dropSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpa
 }
 
 func (d *dropSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
-	// Check for the drop attribute in the finished span.
+	// Check for the drop and keep attributes in the finished span. Keep wins over drop.
+	var drop, keep bool
 	for _, attr := range s.Attributes() {
-		if attr.Key == DropSpanAttribute.Key && attr.Value.AsBool() {
-			// Skip exporting this span.
-			return
+		switch attr.Key {
+		case DropSpanAttribute.Key:
+			drop = attr.Value.AsBool()
+		case KeepSpanAttribute.Key:
+			keep = attr.Value.AsBool()
 		}
 	}
+	if drop && !keep {
+		// Skip exporting this span.
+		return
+	}
 	// Otherwise, pass the span to the next processor.
 	d.processor.OnEnd(s)
 }
@@ -72,25 +215,199 @@ func (d *dropSpanProcessor) ForceFlush(ctx context.Context) error {
 	return d.processor.ForceFlush(ctx)
 }
 
-// InitTracer initializes the OpenTelemetry tracer with google exporter and a drop span processor.
-func InitTracer(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+// TracerOption configures InitTracer.
+type TracerOption func(*tracerConfig)
+
+type tracerConfig struct {
+	disableBaggage bool
+	processors     []sdktrace.SpanProcessor
+	sampler        sdktrace.Sampler
+	flushOnError   time.Duration
+	exporterType   ExporterType
+	droppedNames   []string
+	samplingStats  bool
+	maxClockSkew   time.Duration
+	syncExporter   sdktrace.SpanExporter
+}
+
+// WithSamplingMetrics counts the decisions of the tracer's sampler in a
+// sampling.decisions counter on the global MeterProvider, labeled with a decision
+// attribute: sampled; forced when the middleware's sample rate header or a force
+// rule sampled the span; dropped_by_ratio when a ratio dropped it;
+// dropped_by_name for the names dropped by the filter sampler;
+// dropped_by_parent for the children of an unsampled parent; or dropped for
+// any other reason, such as NeverSample.
+func WithSamplingMetrics() TracerOption {
+	return func(c *tracerConfig) {
+		c.samplingStats = true
+	}
+}
+
+// WithSampler replaces the sampler configured by OTEL_TRACES_SAMPLER. The sampler is still
+// wrapped by the filter that drops exporter self-instrumentation spans.
+func WithSampler(sampler sdktrace.Sampler) TracerOption {
+	return func(c *tracerConfig) {
+		c.sampler = sampler
+	}
+}
+
+// WithDroppedSpanNames sets the span names never sampled, replacing the default
+// Cloud Trace self-instrumentation span. See NewFilterSampler.
+func WithDroppedSpanNames(names ...string) TracerOption {
+	return func(c *tracerConfig) {
+		c.droppedNames = append(c.droppedNames, names...)
+	}
+}
+
+// WithoutBaggagePropagation excludes the W3C baggage propagator so baggage is neither
+// extracted from incoming requests nor injected into outgoing ones. Trace context is
+// still propagated.
+func WithoutBaggagePropagation() TracerOption {
+	return func(c *tracerConfig) {
+		c.disableBaggage = true
+	}
+}
+
+// WithTraceSummaryLogs logs one consolidated line per finished trace, summarizing
+// its spans and their durations. See NewTraceLogProcessor.
+func WithTraceSummaryLogs() TracerOption {
+	return func(c *tracerConfig) {
+		c.processors = append(c.processors, NewTraceLogProcessor(nil))
+	}
+}
+
+// WithBaggageAttributes copies the baggage members named by keys, or every member
+// when keys is empty, onto each span as attributes. See NewBaggageSpanProcessor.
+func WithBaggageAttributes(keys ...string) TracerOption {
+	return func(c *tracerConfig) {
+		c.processors = append(c.processors, NewBaggageSpanProcessor(keys...))
+	}
+}
+
+// WithErrorExporter mirrors spans with an error status to exporter, in addition
+// to the primary exporter. Spans marked with DropSpanAttribute are not mirrored.
+func WithErrorExporter(exporter sdktrace.SpanExporter) TracerOption {
+	return func(c *tracerConfig) {
+		c.processors = append(c.processors,
+			NewDropSpanProcessor(NewErrorSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter))))
+	}
+}
+
+// WithAdditionalExporter also sends every exported span to exporter, with attrs
+// merged over the resource seen by that exporter only. It lets a second backend,
+// such as a legacy system expecting another service.name, receive the same spans.
+// Spans marked with DropSpanAttribute are not sent.
+func WithAdditionalExporter(exporter sdktrace.SpanExporter, attrs ...attribute.KeyValue) TracerOption {
+	return func(c *tracerConfig) {
+		var processor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(exporter)
+		if len(attrs) > 0 {
+			processor = NewResourceOverrideProcessor(processor, attrs...)
+		}
+		c.processors = append(c.processors, NewDropSpanProcessor(processor))
+	}
+}
+
+// defaultMaxClockSkew is the divergence used by WithMonotonicDurations when the
+// given one is not positive.
+const defaultMaxClockSkew = 10 * time.Millisecond
+
+// WithMonotonicDurations measures spans with the monotonic clock and corrects
+// the end time of spans sent to the exporter when their wall-clock duration is off
+// by more than maxDivergence, marking them with ClockSkewKey. A maxDivergence of
+// zero or less selects 10ms, as the two clocks of nearly every span differ by a
+// few nanoseconds. See NewMonotonicSpanProcessor.
+func WithMonotonicDurations(maxDivergence time.Duration) TracerOption {
+	return func(c *tracerConfig) {
+		if maxDivergence <= 0 {
+			maxDivergence = defaultMaxClockSkew
+		}
+		c.maxClockSkew = maxDivergence
+	}
+}
+
+// WithFlushOnError flushes pending spans as soon as a span with an error status
+// ends or an error is logged through the handler installed by SetupLogging, so
+// nothing is lost when a CLI exits right after a failure. Flushes run at most once
+// per minInterval to avoid thrashing when errors come in bursts.
+func WithFlushOnError(minInterval time.Duration) TracerOption {
+	return func(c *tracerConfig) {
+		if minInterval <= 0 {
+			minInterval = time.Nanosecond
+		}
+		c.flushOnError = minInterval
+	}
+}
+
+// WithExporter selects the span exporter, overriding OTEL_TRACES_EXPORTER. It lets
+// tests and processes running several providers configure each one in code.
+func WithExporter(exporterType ExporterType) TracerOption {
+	return func(c *tracerConfig) {
+		c.exporterType = exporterType
+	}
+}
+
+// WithSyncExporter replaces the selected exporter with exporter and sends each
+// span to it synchronously as the span ends, instead of in batches. Tests can then
+// inspect the exported spans right after ending them, for example with a
+// tracetest.InMemoryExporter; see telemetrytest.InitTracer. It is too slow for
+// production use.
+func WithSyncExporter(exporter sdktrace.SpanExporter) TracerOption {
+	return func(c *tracerConfig) {
+		c.syncExporter = exporter
+	}
+}
+
+// newExportProcessor wraps the processor of the exporter with the dropSpanProcessor
+// and, when maxClockSkew is set, the monotonic processor. The monotonic processor
+// keeps state from OnStart to OnEnd, so it goes outside the drop processor, which
+// skips OnEnd for dropped spans.
+func newExportProcessor(next sdktrace.SpanProcessor, maxClockSkew time.Duration) sdktrace.SpanProcessor {
+	processor := NewDropSpanProcessor(next)
+	if maxClockSkew > 0 {
+		processor = NewMonotonicSpanProcessor(maxClockSkew, processor)
+	}
+	return processor
+}
+
+// InitTracerWithOptions is InitTracer. It is provided for symmetry with
+// TracingMiddlewareWithOptions.
+func InitTracerWithOptions(ctx context.Context, serviceName string, opts ...TracerOption) (func(context.Context) error, error) {
+	return InitTracer(ctx, serviceName, opts...)
+}
+
+// InitTracer initializes the OpenTelemetry tracer with a drop span processor. Unless
+// WithExporter is given, the exporter is selected by OTEL_TRACES_EXPORTER ("gcp" by
+// default, "otlp", "console" or "chrometrace"), and unless WithSampler is given,
+// the sampler by OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG. The batch span
+// processor is tuned by the OTEL_BSP_* variables, and its settings are logged.
+func InitTracer(ctx context.Context, serviceName string, opts ...TracerOption) (func(context.Context) error, error) {
+	cfg := &tracerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.sampler == nil {
+		cfg.sampler = samplerFromEnv()
+	}
+
 	var shutdownFuncs []func(context.Context) error
 
-	// Create a cleanup function that combines all shutdown functions
+	// Create a cleanup function that combines all shutdown functions. They run in
+	// reverse order so the provider flushes pending spans before the exporter closes.
 	shutdown := func(ctx context.Context) error {
 		var err error
-		for _, fn := range shutdownFuncs {
-			err = errors.Join(err, fn(ctx))
+		for i := len(shutdownFuncs) - 1; i >= 0; i-- {
+			err = errors.Join(err, shutdownFuncs[i](ctx))
 		}
 		shutdownFuncs = nil
 		return err
 	}
 
 	// Configure Context Propagation to use the default W3C traceparent format
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	propagators := []propagation.TextMapPropagator{propagation.TraceContext{}}
+	if !cfg.disableBaggage {
+		propagators = append(propagators, propagation.Baggage{})
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagators...))
 
 	// Create resource with service information and auto-detected metadata
 	res, err := GetResource(ctx, serviceName)
@@ -98,28 +415,63 @@ func InitTracer(ctx context.Context, serviceName string) (func(context.Context)
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	// Configure Trace Export to send spans as OTLP
-	exporter, err := texporter.New()
-	if err != nil {
-		err = errors.Join(err, shutdown(ctx))
-		return shutdown, fmt.Errorf("failed to create trace exporter: %w", err)
+	// Configure Trace Export using the selected exporter
+	exporter := cfg.syncExporter
+	if exporter == nil {
+		exporter, err = createTraceExporter(ctx, cfg.exporterType)
+		if err != nil {
+			err = errors.Join(err, shutdown(ctx))
+			return shutdown, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
 	}
 
 	shutdownFuncs = append(shutdownFuncs, exporter.Shutdown)
 
-	// Create a BatchSpanProcessor and wrap it with the dropSpanProcessor.
-	batchProcessor := sdktrace.NewBatchSpanProcessor(exporter)
-	dropProcessor := NewDropSpanProcessor(batchProcessor)
+	// Create a BatchSpanProcessor, or a synchronous one for WithSyncExporter, and
+	// wrap it with the dropSpanProcessor.
+	var batchProcessor sdktrace.SpanProcessor
+	if cfg.syncExporter != nil {
+		batchProcessor = sdktrace.NewSimpleSpanProcessor(exporter)
+	} else {
+		batchCfg := batchConfigFromEnv()
+		batchCfg.log(ctx)
+		batchProcessor = sdktrace.NewBatchSpanProcessor(exporter, batchCfg.options()...)
+	}
+	dropProcessor := newExportProcessor(batchProcessor, cfg.maxClockSkew)
+
+	sampler := newFilterSampler(cfg.sampler, cfg.droppedNames...)
+	if cfg.samplingStats {
+		sampler.decisions = newSamplingDecisionCounter()
+	}
 
-	// Create TracerProvider with the drop span processor.
-	tp := sdktrace.NewTracerProvider(
+	// Create TracerProvider with the drop span processor and any additional processors.
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(transactionIDProcessor{}),
 		sdktrace.WithSpanProcessor(dropProcessor),
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(&filterSampler{
-			baseSampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1.0)),
-		}),
-	)
+		sdktrace.WithSampler(sampler),
+	}
+	for _, processor := range cfg.processors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(processor))
+	}
+	// The flusher is bound to the provider, which is assigned below before any span starts.
+	var tp *sdktrace.TracerProvider
+	var flusher *errorFlusher
+	if cfg.flushOnError > 0 {
+		flusher = newErrorFlusher(cfg.flushOnError, func(ctx context.Context) error {
+			return tp.ForceFlush(ctx)
+		})
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(&flushOnErrorProcessor{flusher: flusher}))
+	}
+	tp = sdktrace.NewTracerProvider(tpOpts...)
 	shutdownFuncs = append(shutdownFuncs, tp.Shutdown)
+	if flusher != nil {
+		activeErrorFlusher.Store(flusher)
+		shutdownFuncs = append(shutdownFuncs, func(context.Context) error {
+			activeErrorFlusher.CompareAndSwap(flusher, nil)
+			return nil
+		})
+	}
 
 	// Set the global TracerProvider
 	otel.SetTracerProvider(tp)
@@ -127,13 +479,83 @@ func InitTracer(ctx context.Context, serviceName string) (func(context.Context)
 	return shutdown, nil
 }
 
+// Version and Commit identify the running build and are stamped on the resource,
+// and so on every span, when set. They are empty by default and meant to be set at
+// link time:
+//
+//	go build -ldflags "-X github.com/polymerdao/telemetry.Version=v1.2.3 -X github.com/polymerdao/telemetry.Commit=$(git rev-parse HEAD)"
+var (
+	Version string
+	Commit  string
+)
+
 // GetResource returns the configured resource with all detected attributes
 func GetResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
-	return resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-		),
+	return GetResourceWithAttributes(ctx, serviceName)
+}
+
+// GetResourceWithAttributes returns the resource of GetResource merged with attrs,
+// such as deployment.environment or custom labels. Attributes from
+// OTEL_RESOURCE_ATTRIBUTES are included too. On collisions, attrs win over the
+// service attributes, which win over the environment. Malformed entries of
+// OTEL_RESOURCE_ATTRIBUTES are logged and skipped.
+func GetResourceWithAttributes(ctx context.Context, serviceName string, attrs ...attribute.KeyValue) (*resource.Resource, error) {
+	if strings.TrimSpace(serviceName) == "" {
+		serviceName = defaultServiceName()
+		slog.Warn("empty service name, using a fallback", "service", serviceName)
+	}
+	serviceAttrs := []attribute.KeyValue{semconv.ServiceName(serviceName)}
+	if Version != "" {
+		serviceAttrs = append(serviceAttrs, semconv.ServiceVersion(Version))
+	}
+	if Commit != "" {
+		serviceAttrs = append(serviceAttrs, attribute.String("vcs.ref.head.revision", Commit))
+	}
+	// Later options take precedence when keys collide.
+	configured, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(serviceAttrs...),
+		resource.WithAttributes(attrs...),
 	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.WarnContext(ctx, "ignoring malformed OTEL_RESOURCE_ATTRIBUTES entries", "error", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return resource.Merge(detectResource(ctx), configured)
+}
+
+// detectResource describes the host, process and SDK. The process command line is
+// left out as it may contain secrets. Detection is best effort: a failing detector,
+// such as os.Hostname in a restricted container, is logged and skipped.
+func detectResource(ctx context.Context) *resource.Resource {
+	detected, err := resource.New(ctx,
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to detect some resource attributes", "error", err)
+	}
+	if detected == nil {
+		return resource.Empty()
+	}
+	return detected
+}
+
+// defaultServiceName is used when no service name is given. It prefers
+// OTEL_SERVICE_NAME and falls back to the executable name.
+func defaultServiceName() string {
+	if name := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME")); name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
 }
 
 // GetParentContext creates a new context with OpenTelemetry trace context from a traceID
@@ -156,23 +578,151 @@ func GetParentContext(ctx context.Context, traceID string) context.Context {
 type tracer struct {
 	name   string
 	tracer trace.Tracer
+
+	// nameTemplate and nameKey replace caller-based naming when the span
+	// carries the nameKey attribute. See WithSpanNameTemplate.
+	nameTemplate string
+	nameKey      attribute.Key
+
+	// recordDeadline adds the remaining context budget at span start.
+	recordDeadline bool
+
+	// attrs are added to every span, such as the plugin name of a scoped tracer.
+	attrs []attribute.KeyValue
+
+	// scopeOpts configure the instrumentation scope of the underlying tracer.
+	scopeOpts []trace.TracerOption
+
+	// global is set when tracer comes from the global TracerProvider, which
+	// delegates to the provider installed later by InitTracer.
+	global bool
 }
 
+// unsetTracerProvider is the global TracerProvider before one is installed. Its
+// tracers discard spans until then.
+var unsetTracerProvider = otel.GetTracerProvider()
+
 type Tracer interface {
 	Span(ctx context.Context, opts ...trace.SpanStartOption) (context.Context, trace.Span)
 }
 
-func NewTracer(name string) Tracer {
-	return &tracer{
-		name:   name,
-		tracer: otel.Tracer(name),
+// NewTracerOption configures a Tracer created by NewTracer.
+type NewTracerOption func(*tracer)
+
+// WithSpanNameTemplate names spans from a template instead of the caller function.
+// The {placeholder} in template is replaced with the value of the key attribute
+// passed at span start, so "db.{operation}" with key "db.operation" and the
+// attribute db.operation=select yields "db.select". Spans without the attribute
+// keep caller-based naming.
+func WithSpanNameTemplate(template string, key attribute.Key) NewTracerOption {
+	return func(t *tracer) {
+		t.nameTemplate = template
+		t.nameKey = key
 	}
 }
 
+// WithInstrumentationVersion sets the version of the instrumentation scope of the
+// tracer, such as the version of the library it instruments, which some backends
+// use to group spans.
+func WithInstrumentationVersion(version string) NewTracerOption {
+	return func(t *tracer) {
+		t.scopeOpts = append(t.scopeOpts, trace.WithInstrumentationVersion(version))
+	}
+}
+
+// WithSchemaURL sets the semantic conventions schema URL of the instrumentation
+// scope of the tracer.
+func WithSchemaURL(schemaURL string) NewTracerOption {
+	return func(t *tracer) {
+		t.scopeOpts = append(t.scopeOpts, trace.WithSchemaURL(schemaURL))
+	}
+}
+
+// tracerCache shares the tracers created by NewTracer without options.
+var tracerCache = struct {
+	sync.Mutex
+	tracers map[string]tracerCacheEntry
+}{tracers: make(map[string]tracerCacheEntry)}
+
+type tracerCacheEntry struct {
+	provider trace.TracerProvider
+	tracer   *tracer
+}
+
+// WithDeadlineAttribute records the time remaining before the context deadline,
+// in milliseconds, as the sla.deadline_ms attribute of spans started with a
+// deadline. It shows how close operations run to their budget.
+func WithDeadlineAttribute() NewTracerOption {
+	return func(t *tracer) {
+		t.recordDeadline = true
+	}
+}
+
+// NewTracer returns a Tracer whose span names are prefixed with name. Calls
+// without options share one instance per name until the global TracerProvider
+// is replaced.
+func NewTracer(name string, opts ...NewTracerOption) Tracer {
+	if len(opts) > 0 {
+		return newTracer(name, opts...)
+	}
+
+	provider := otel.GetTracerProvider()
+	tracerCache.Lock()
+	defer tracerCache.Unlock()
+	if entry, ok := tracerCache.tracers[name]; ok && entry.provider == provider {
+		return entry.tracer
+	}
+	t := newTracer(name)
+	tracerCache.tracers[name] = tracerCacheEntry{provider: provider, tracer: t}
+	return t
+}
+
+// PluginNameKey is the span attribute naming the plugin of a tracer created by
+// NewScopedTracer.
+const PluginNameKey = "plugin.name"
+
+// NewScopedTracer returns a Tracer for a plugin, whose spans are prefixed with
+// pluginName and carry it as PluginNameKey. It uses the global TracerProvider
+// without changing it. When enabled is false, the tracer is a noop, so a plugin
+// can be silenced without affecting the tracing of the others.
+func NewScopedTracer(pluginName string, enabled bool, opts ...NewTracerOption) Tracer {
+	if !enabled {
+		return &tracer{
+			name:   pluginName,
+			tracer: noop.NewTracerProvider().Tracer(pluginName),
+		}
+	}
+	t := newTracer(pluginName, opts...)
+	t.attrs = append(t.attrs, attribute.String(PluginNameKey, pluginName))
+	return t
+}
+
+func newTracer(name string, opts ...NewTracerOption) *tracer {
+	t := &tracer{name: name}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.tracer = otel.Tracer(name, t.scopeOpts...)
+	t.global = true
+	return t
+}
+
 // Span creates a new span with the caller function name appended to the tracer name.
 // For example, if the tracer name is "myapp" and the caller function is "DoWork",
 // the span name will be "myapp.DoWork".
 func (t *tracer) Span(ctx context.Context, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	// A tracer that discards spans never records the name, so skip the caller
+	// lookup.
+	if tracer := tracerFor(ctx, t.tracer); t.discards(tracer) {
+		return tracer.Start(ctx, t.name, opts...)
+	}
+	if spanName, ok := t.templatedName(opts); ok {
+		return t.start(ctx, spanName, opts)
+	}
+	if highThroughputMode.Load() {
+		return t.start(ctx, t.name, opts)
+	}
+
 	caller := "<unknown>"
 	if pc, _, _, ok := runtime.Caller(1); ok {
 		fn := runtime.FuncForPC(pc).Name()
@@ -183,7 +733,38 @@ func (t *tracer) Span(ctx context.Context, opts ...trace.SpanStartOption) (conte
 		}
 	}
 	spanName := fmt.Sprintf("%s.%s", t.name, caller)
-	return t.tracer.Start(ctx, spanName, opts...)
+	return t.start(ctx, spanName, opts)
+}
+
+// discards reports whether tracer never records spans: it is a noop tracer, also
+// used when ctx suppresses spans, or t comes from a global TracerProvider that
+// is not installed yet or is a noop.
+func (t *tracer) discards(tracer trace.Tracer) bool {
+	if _, ok := tracer.(noop.Tracer); ok {
+		return true
+	}
+	if !t.global {
+		return false
+	}
+	provider := otel.GetTracerProvider()
+	if _, ok := provider.(noop.TracerProvider); ok {
+		return true
+	}
+	return provider == unsetTracerProvider
+}
+
+func (t *tracer) start(ctx context.Context, spanName string, opts []trace.SpanStartOption) (context.Context, trace.Span) {
+	if len(t.attrs) > 0 {
+		opts = append(opts, trace.WithAttributes(t.attrs...))
+	}
+	if t.recordDeadline {
+		if deadline, ok := ctx.Deadline(); ok {
+			opts = append(opts, trace.WithAttributes(
+				attribute.Int64("sla.deadline_ms", time.Until(deadline).Milliseconds()),
+			))
+		}
+	}
+	return t.tracer.Start(ctx, truncateSpanName(spanName), opts...)
 }
 
 func NewNoopTracer() Tracer {
@@ -192,3 +773,62 @@ func NewNoopTracer() Tracer {
 		tracer: noop.NewTracerProvider().Tracer("noop"),
 	}
 }
+
+// templatedName resolves the span name template from the start attributes.
+func (t *tracer) templatedName(opts []trace.SpanStartOption) (string, bool) {
+	if t.nameTemplate == "" {
+		return "", false
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	for _, attr := range cfg.Attributes() {
+		if attr.Key != t.nameKey {
+			continue
+		}
+		start := strings.Index(t.nameTemplate, "{")
+		end := strings.Index(t.nameTemplate, "}")
+		if start == -1 || end < start {
+			return t.nameTemplate, true
+		}
+		return t.nameTemplate[:start] + attr.Value.Emit() + t.nameTemplate[end+1:], true
+	}
+	return "", false
+}
+
+// spanNameEllipsis marks span names and attribute values shortened by truncateString.
+const spanNameEllipsis = "..."
+
+// maxSpanNameLength is the maximum span name length in bytes; 0 disables truncation.
+var maxSpanNameLength atomic.Int64
+
+func init() {
+	maxSpanNameLength.Store(256)
+}
+
+// SetMaxSpanNameLength sets the maximum length in bytes of span names created by
+// Tracer.Span and TracingMiddleware. Longer names are cut and end with "...".
+// The default is 256; n <= 0 disables truncation.
+func SetMaxSpanNameLength(n int) {
+	maxSpanNameLength.Store(int64(n))
+}
+
+// truncateSpanName shortens name to the configured maximum without splitting a
+// UTF-8 sequence.
+func truncateSpanName(name string) string {
+	return truncateString(name, int(maxSpanNameLength.Load()))
+}
+
+// truncateString cuts s to limit bytes, ending it with "...", without splitting a
+// UTF-8 sequence. A limit <= 0 disables truncation.
+func truncateString(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	if limit <= len(spanNameEllipsis) {
+		return spanNameEllipsis[:limit]
+	}
+	cut := limit - len(spanNameEllipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + spanNameEllipsis
+}
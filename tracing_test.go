@@ -1,10 +1,29 @@
 package telemetry
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestFilterSampler_ShouldSample(t *testing.T) {
@@ -52,9 +71,7 @@ func TestFilterSampler_ShouldSample(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sampler := &filterSampler{
-				baseSampler: &testSampler{result: tt.baseSample},
-			}
+			sampler := NewFilterSampler(&testSampler{result: tt.baseSample})
 
 			got := sampler.ShouldSample(tt.params)
 
@@ -67,6 +84,140 @@ func TestFilterSampler_ShouldSample(t *testing.T) {
 	}
 }
 
+func TestFilterSamplerDropNames(t *testing.T) {
+	sampler := NewFilterSampler(sdktrace.AlwaysSample(), "opentelemetry.proto.collector.trace.v1.TraceService/Export", "noisy")
+
+	for name, wantDrop := range map[string]bool{
+		"opentelemetry.proto.collector.trace.v1.TraceService/Export": true,
+		"noisy": true,
+		"google.devtools.cloudtrace.v2.TraceService/BatchWriteSpans": false,
+		"regular": false,
+	} {
+		got := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), Name: name})
+		require.Equal(t, wantDrop, got.Decision == sdktrace.Drop, name)
+	}
+}
+
+func TestInitTracerSamplingMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	initTestTracer(t, WithSampler(NewSpanKindSampler(sdktrace.NeverSample())), WithSamplingMetrics())
+	tracer := otel.Tracer("test")
+	start := func(ctx context.Context, name string, opts ...trace.SpanStartOption) {
+		_, span := tracer.Start(ctx, name, opts...)
+		span.End()
+	}
+	ctx := context.Background()
+	start(ctx, "request", trace.WithSpanKind(trace.SpanKindServer))
+	start(ctx, "request", trace.WithSpanKind(trace.SpanKindServer))
+	start(ctx, "internal")
+	start(ctx, "google.devtools.cloudtrace.v2.TraceService/BatchWriteSpans")
+	start(contextWithSampleRate(ctx, 1), "internal")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "sampling.decisions" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				decision, _ := dp.Attributes.Value("decision")
+				counts[decision.AsString()] = dp.Value
+			}
+		}
+	}
+	require.Equal(t, map[string]int64{
+		"sampled":         2,
+		"forced":          1,
+		"dropped":         1,
+		"dropped_by_name": 1,
+	}, counts)
+}
+
+func TestInitTracerWithSamplerSkipsEnv(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Setenv("OTEL_TRACES_SAMPLER", "traceidratio")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "not a ratio")
+
+	initTestTracer(t, WithSampler(sdktrace.AlwaysSample()))
+	require.NotContains(t, buf.String(), "invalid traces sampler ratio")
+}
+
+func TestFilterSamplerDecisionLabels(t *testing.T) {
+	parentCtx := func(flags trace.TraceFlags) context.Context {
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01},
+			SpanID:     trace.SpanID{0x02},
+			TraceFlags: flags,
+		}))
+	}
+	never := 0.0
+	policy := newPolicySampler(&samplerPolicy{
+		DefaultRatio: &never,
+		ForceSample:  []forceSampleRule{{Attribute: "priority", Value: "high"}},
+	})
+	chain, ok := samplerChainFromEnv("ratio:0,force:priority=high")
+	require.True(t, ok)
+	priority := attribute.String("priority", "high")
+
+	tests := []struct {
+		name    string
+		sampler sdktrace.Sampler
+		ctx     context.Context
+		attrs   []attribute.KeyValue
+		want    string
+	}{
+		{name: "sdk ratio", sampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0)), want: decisionDroppedByRatio},
+		{name: "sdk parent", sampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1)), ctx: parentCtx(0), want: decisionDroppedByParent},
+		{name: "sdk never", sampler: sdktrace.NeverSample(), want: decisionDropped},
+		{name: "policy ratio", sampler: policy, want: decisionDroppedByRatio},
+		{name: "policy force", sampler: policy, attrs: []attribute.KeyValue{priority}, want: decisionForced},
+		{name: "policy parent", sampler: policy, ctx: parentCtx(0), attrs: []attribute.KeyValue{priority}, want: decisionDroppedByParent},
+		{name: "policy sampled parent", sampler: policy, ctx: parentCtx(trace.FlagsSampled), want: decisionSampled},
+		{name: "chain ratio", sampler: chain, want: decisionDroppedByRatio},
+		{name: "chain force", sampler: chain, attrs: []attribute.KeyValue{priority}, want: decisionForced},
+		{name: "chain parent", sampler: chain, ctx: parentCtx(0), want: decisionDroppedByParent},
+		{name: "sample rate header", sampler: sdktrace.NeverSample(), ctx: contextWithSampleRate(context.Background(), 1), want: decisionForced},
+		{name: "sample rate header drop", sampler: sdktrace.AlwaysSample(), ctx: contextWithSampleRate(context.Background(), 0), want: decisionDroppedByRatio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			counter, err := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test").Int64Counter("sampling.decisions")
+			require.NoError(t, err)
+			f := newFilterSampler(tt.sampler)
+			f.decisions = counter
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			f.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: ctx,
+				TraceID:       trace.TraceID{0x01},
+				Name:          "span",
+				Attributes:    tt.attrs,
+			})
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+			points := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints
+			require.Len(t, points, 1)
+			decision, _ := points[0].Attributes.Value("decision")
+			require.Equal(t, tt.want, decision.AsString())
+		})
+	}
+}
+
 // testSampler is a mock sampler for testing
 type testSampler struct {
 	result sdktrace.SamplingResult
@@ -79,3 +230,371 @@ func (s *testSampler) ShouldSample(parameters sdktrace.SamplingParameters) sdktr
 func (s *testSampler) Description() string {
 	return "test sampler"
 }
+
+// initTestTracer runs InitTracer with an OTLP exporter that never receives spans
+// and restores the global provider and propagator when the test ends.
+func initTestTracer(t *testing.T, opts ...TracerOption) {
+	t.Helper()
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:0")
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	shutdown, err := InitTracer(context.Background(), "test-service", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = shutdown(context.Background())
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+}
+
+func TestInitTracerBaggagePropagation(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []TracerOption
+		wantBaggage bool
+	}{
+		{name: "baggage enabled by default", wantBaggage: true},
+		{name: "baggage disabled", opts: []TracerOption{WithoutBaggagePropagation()}, wantBaggage: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestTracer(t, tt.opts...)
+
+			member, err := baggage.NewMember("tenant", "acme")
+			require.NoError(t, err)
+			bag, err := baggage.New(member)
+			require.NoError(t, err)
+			ctx := baggage.ContextWithBaggage(context.Background(), bag)
+			ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    trace.TraceID{0x01},
+				SpanID:     trace.SpanID{0x02},
+				TraceFlags: trace.FlagsSampled,
+			}))
+
+			carrier := propagation.MapCarrier{}
+			otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+			require.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", carrier.Get("traceparent"))
+			if tt.wantBaggage {
+				require.Equal(t, "tenant=acme", carrier.Get("baggage"))
+			} else {
+				require.Empty(t, carrier.Get("baggage"))
+			}
+		})
+	}
+}
+
+func TestInitTracerWithExporter(t *testing.T) {
+	srv, requests := newOTLPTestServer(t)
+	// The environment names an exporter that does not exist; the option wins
+	t.Setenv("OTEL_TRACES_EXPORTER", "bogus")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	_, err := InitTracerWithOptions(context.Background(), "test-service")
+	require.ErrorContains(t, err, `unsupported traces exporter "bogus"`)
+
+	shutdown, err := InitTracerWithOptions(context.Background(), "test-service", WithExporter(ExporterOTLP))
+	require.NoError(t, err)
+	_, span := otel.Tracer("test").Start(context.Background(), "exported")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	require.Equal(t, "/v1/traces", (<-requests).URL.Path)
+}
+
+func TestGetResourceVersion(t *testing.T) {
+	prevVersion, prevCommit := Version, Commit
+	t.Cleanup(func() { Version, Commit = prevVersion, prevCommit })
+
+	res, err := GetResource(context.Background(), "test-service")
+	require.NoError(t, err)
+	_, ok := res.Set().Value("service.version")
+	require.False(t, ok, "version is not set by default")
+
+	Version, Commit = "v1.2.3", "0123abcd"
+	res, err = GetResource(context.Background(), "test-service")
+	require.NoError(t, err)
+
+	version, _ := res.Set().Value("service.version")
+	require.Equal(t, "v1.2.3", version.AsString())
+	commit, _ := res.Set().Value("vcs.ref.head.revision")
+	require.Equal(t, "0123abcd", commit.AsString())
+}
+
+func TestGetResourceWithAttributes(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=prod,region=us-east1,service.name=env-name")
+
+	res, err := GetResourceWithAttributes(context.Background(), "test-service",
+		attribute.String("region", "europe-west1"),
+		attribute.String("team", "core"),
+	)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"service.name":           "test-service",
+		"deployment.environment": "prod",
+		"region":                 "europe-west1",
+		"team":                   "core",
+	}
+	for key, value := range want {
+		got, ok := res.Set().Value(attribute.Key(key))
+		require.True(t, ok, key)
+		require.Equal(t, value, got.AsString(), key)
+	}
+}
+
+func TestGetResourceMalformedEnv(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=prod,malformed")
+
+	res, err := GetResource(context.Background(), "test-service")
+	require.NoError(t, err)
+	env, ok := res.Set().Value("deployment.environment")
+	require.True(t, ok)
+	require.Equal(t, "prod", env.AsString())
+	name, _ := res.Set().Value("service.name")
+	require.Equal(t, "test-service", name.AsString())
+}
+
+func TestGetResourceDetectors(t *testing.T) {
+	res, err := GetResource(context.Background(), "test-service")
+	require.NoError(t, err)
+
+	for _, key := range []attribute.Key{"host.name", "os.type", "process.pid", "process.runtime.version", "telemetry.sdk.language"} {
+		_, ok := res.Set().Value(key)
+		require.True(t, ok, key)
+	}
+	_, ok := res.Set().Value("process.command_args")
+	require.False(t, ok, "the command line may contain secrets")
+	name, _ := res.Set().Value("service.name")
+	require.Equal(t, "test-service", name.AsString())
+}
+
+func TestGetResourceEmptyServiceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		envName string
+		want    string
+	}{
+		{name: "executable name", want: filepath.Base(os.Args[0])},
+		{name: "OTEL_SERVICE_NAME", envName: "env-service", want: "env-service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_SERVICE_NAME", tt.envName)
+			res, err := GetResource(context.Background(), " ")
+			require.NoError(t, err)
+			name, _ := res.Set().Value("service.name")
+			require.Equal(t, tt.want, name.AsString())
+		})
+	}
+}
+
+func TestTracerSpanNameTemplate(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	tracer := NewTracer("db", WithSpanNameTemplate("db.{operation}", "db.operation"))
+
+	_, span := tracer.Span(context.Background(), trace.WithAttributes(attribute.String("db.operation", "select")))
+	span.End()
+	_, span = tracer.Span(context.Background())
+	span.End()
+
+	require.Len(t, recorder.Ended(), 2)
+	require.Equal(t, "db.select", recorder.Ended()[0].Name())
+	require.Equal(t, "db.TestTracerSpanNameTemplate", recorder.Ended()[1].Name())
+}
+
+func TestTracerSpanName(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	_, span := NewTracer("svc").Span(context.Background())
+	span.End()
+	require.Len(t, recorder.Ended(), 1)
+	require.Equal(t, "svc.TestTracerSpanName", recorder.Ended()[0].Name())
+
+	// The noop tracer skips naming but still propagates the parent
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{0x01}, SpanID: trace.SpanID{0x02}})
+	ctx, span := NewNoopTracer().Span(trace.ContextWithSpanContext(context.Background(), parent))
+	require.False(t, span.IsRecording())
+	require.Equal(t, parent, trace.SpanContextFromContext(ctx))
+}
+
+func BenchmarkTracerSpan(b *testing.B) {
+	b.Run("noop", func(b *testing.B) {
+		tracer := NewNoopTracer()
+		ctx := context.Background()
+		b.ReportAllocs()
+		for b.Loop() {
+			_, span := tracer.Span(ctx)
+			span.End()
+		}
+	})
+	b.Run("before InitTracer", func(b *testing.B) {
+		if otel.GetTracerProvider() != unsetTracerProvider {
+			b.Skip("a TracerProvider is already installed")
+		}
+		tracer := NewTracer("bench")
+		ctx := context.Background()
+		b.ReportAllocs()
+		for b.Loop() {
+			_, span := tracer.Span(ctx)
+			span.End()
+		}
+	})
+	b.Run("recording", func(b *testing.B) {
+		tp := sdktrace.NewTracerProvider()
+		defer tp.Shutdown(context.Background())
+		tr := &tracer{name: "bench", tracer: tp.Tracer("bench")}
+		ctx := context.Background()
+		b.ReportAllocs()
+		for b.Loop() {
+			_, span := tr.Span(ctx)
+			span.End()
+		}
+	})
+}
+
+func TestNewTracerInstrumentationScope(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	_, span := NewTracer("versioned",
+		WithInstrumentationVersion("v1.2.3"),
+		WithSchemaURL("https://opentelemetry.io/schemas/1.26.0"),
+	).Span(context.Background())
+	span.End()
+	_, plain := NewTracer("plain").Span(context.Background())
+	plain.End()
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	scope := ended[0].InstrumentationScope()
+	require.Equal(t, "versioned", scope.Name)
+	require.Equal(t, "v1.2.3", scope.Version)
+	require.Equal(t, "https://opentelemetry.io/schemas/1.26.0", scope.SchemaURL)
+	require.Empty(t, ended[1].InstrumentationScope().Version)
+}
+
+func TestNewTracerCache(t *testing.T) {
+	setTestTracerProvider(t)
+
+	const n = 50
+	tracers := make(chan Tracer, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tracers <- NewTracer("cached")
+		}()
+	}
+	wg.Wait()
+	close(tracers)
+
+	first := NewTracer("cached")
+	for tr := range tracers {
+		require.Same(t, first, tr)
+	}
+	require.NotSame(t, first, NewTracer("other"))
+
+	// Replacing the provider invalidates the cache
+	setTestTracerProvider(t)
+	require.NotSame(t, first, NewTracer("cached"))
+}
+
+func TestNewScopedTracer(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+
+	_, span := NewScopedTracer("billing", true).Span(context.Background())
+	span.End()
+	_, span = NewScopedTracer("search", false).Span(context.Background())
+	require.False(t, span.IsRecording())
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1, "disabled scoped tracers produce no spans")
+	require.Equal(t, "billing.TestNewScopedTracer", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.String(PluginNameKey, "billing"))
+}
+
+func TestTruncateSpanName(t *testing.T) {
+	t.Cleanup(func() { SetMaxSpanNameLength(256) })
+	recorder := setTestTracerProvider(t)
+	SetMaxSpanNameLength(100)
+
+	long := strings.Repeat("a", 2048)
+	tracer := NewTracer("svc", WithSpanNameTemplate("svc.{op}", "op"))
+	_, span := tracer.Span(context.Background(), trace.WithAttributes(attribute.String("op", long)))
+	span.End()
+
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	body := fmt.Sprintf(`{"method":%q}`, long)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	require.Len(t, recorder.Ended(), 2)
+	for _, s := range recorder.Ended() {
+		require.Len(t, s.Name(), 100)
+		require.True(t, strings.HasSuffix(s.Name(), "..."))
+	}
+
+	// Multi-byte characters are not split
+	SetMaxSpanNameLength(6)
+	require.Equal(t, "ab...", truncateSpanName("abééé"))
+
+	SetMaxSpanNameLength(0)
+	require.Equal(t, long, truncateSpanName(long))
+}
+
+func TestDropSpanProcessor(t *testing.T) {
+	tests := []struct {
+		name     string
+		attrs    []attribute.KeyValue
+		wantKept bool
+	}{
+		{name: "no attributes", wantKept: true},
+		{name: "drop", attrs: []attribute.KeyValue{DropSpanAttribute}, wantKept: false},
+		{name: "keep overrides drop", attrs: []attribute.KeyValue{DropSpanAttribute, KeepSpanAttribute}, wantKept: true},
+		{name: "keep=false does not override", attrs: []attribute.KeyValue{DropSpanAttribute, attribute.Bool("keep", false)}, wantKept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewDropSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))))
+			defer tp.Shutdown(context.Background())
+
+			_, span := tp.Tracer("test").Start(context.Background(), "span", trace.WithAttributes(tt.attrs...))
+			span.End()
+
+			require.Equal(t, tt.wantKept, len(exporter.GetSpans()) == 1)
+		})
+	}
+}
+
+func TestTracerDeadlineAttribute(t *testing.T) {
+	recorder := setTestTracerProvider(t)
+	tracer := NewTracer("svc", WithDeadlineAttribute())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, span := tracer.Span(ctx)
+	span.End()
+	_, span = tracer.Span(context.Background())
+	span.End()
+
+	require.Len(t, recorder.Ended(), 2)
+	var remaining int64 = -1
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		if kv.Key == "sla.deadline_ms" {
+			remaining = kv.Value.AsInt64()
+		}
+	}
+	require.InDelta(t, 1000, remaining, 100)
+	require.Empty(t, recorder.Ended()[1].Attributes(), "no attribute without a deadline")
+}